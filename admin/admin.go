@@ -0,0 +1,450 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henges/newznab-proxy/proxy"
+	"github.com/samber/lo"
+)
+
+// BasePath is the path the admin API is served under.
+const BasePath = "/admin/api"
+
+type Handler struct {
+	p      *proxy.Proxy
+	apiKey string
+	mux    *http.ServeMux
+}
+
+// NewHandler returns the admin API for p. Every request must carry apiKey,
+// either in the X-Api-Key header or the apikey query parameter.
+func NewHandler(p *proxy.Proxy, apiKey string) *Handler {
+
+	h := &Handler{
+		p:      p,
+		apiKey: apiKey,
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET "+BasePath+"/backends", h.listBackends)
+	h.mux.HandleFunc("GET "+BasePath+"/feeds", h.listFeeds)
+	h.mux.HandleFunc("GET "+BasePath+"/feeds/{backend}/{feed}/runs", h.listFeedRuns)
+	h.mux.HandleFunc("POST "+BasePath+"/feeds/{backend}/{feed}/poll", h.pollFeed)
+	h.mux.HandleFunc("GET "+BasePath+"/search-cache", h.listSearchCache)
+	h.mux.HandleFunc("DELETE "+BasePath+"/search-cache", h.purgeSearchCache)
+	h.mux.HandleFunc("GET "+BasePath+"/items", h.listItems)
+	h.mux.HandleFunc("GET "+BasePath+"/grabs", h.listGrabs)
+	h.mux.HandleFunc("GET "+BasePath+"/grabs/stats", h.grabStats)
+	h.mux.HandleFunc("GET "+BasePath+"/grabs/check", h.checkGrabbed)
+	h.mux.HandleFunc("GET "+BasePath+"/search-log", h.listSearchLog)
+	h.mux.HandleFunc("GET "+BasePath+"/search-log/top", h.topQueries)
+	h.mux.HandleFunc("GET "+BasePath+"/search-log/zero-results", h.zeroResultQueries)
+	h.mux.HandleFunc("GET "+BasePath+"/search-log/backends", h.backendContributions)
+	h.mux.HandleFunc("POST "+BasePath+"/prune", h.prune)
+	h.mux.HandleFunc("GET "+BasePath+"/search-index", h.checkSearchIndex)
+	h.mux.HandleFunc("POST "+BasePath+"/search-index/rebuild", h.rebuildSearchIndex)
+	return h
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		key = r.URL.Query().Get("apikey")
+	}
+	if h.apiKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(h.apiKey)) != 1 {
+		respondError(rw, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	h.mux.ServeHTTP(rw, r)
+}
+
+func (h *Handler) listBackends(rw http.ResponseWriter, r *http.Request) {
+
+	res, err := h.p.BackendStatuses(r.Context())
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+func (h *Handler) listFeeds(rw http.ResponseWriter, r *http.Request) {
+
+	res, err := h.p.FeedStatuses(r.Context())
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+func (h *Handler) listFeedRuns(rw http.ResponseWriter, r *http.Request) {
+
+	limit, ok := limitParam(rw, r, 50)
+	if !ok {
+		return
+	}
+	res, err := h.p.FeedPollRuns(r.Context(), r.PathValue("backend"), r.PathValue("feed"), limit)
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// pollFeed polls a feed immediately, responding with the recorded run. A
+// failed poll is not an error here; the run's error says why it failed.
+func (h *Handler) pollFeed(rw http.ResponseWriter, r *http.Request) {
+
+	run, err := h.p.PollFeed(r.Context(), r.PathValue("backend"), r.PathValue("feed"))
+	if errors.Is(err, proxy.ErrNoSuchFeed) {
+		respondError(rw, http.StatusNotFound, err.Error())
+		return
+	}
+	respondJSON(rw, run)
+}
+
+func (h *Handler) listSearchCache(rw http.ResponseWriter, r *http.Request) {
+
+	limit, ok := limitParam(rw, r, 100)
+	if !ok {
+		return
+	}
+	offset, ok := intParam(rw, r, "offset", 0)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	res, err := h.p.SearchCache(r.Context(), proxy.SearchCacheQuery{
+		IndexerName: q.Get("backend"),
+		Status:      proxy.SearchResultStatus(q.Get("status")),
+		Query:       q.Get("query"),
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// purgeSearchCache deletes search cache entries, optionally only those of
+// one backend or those last tried at least olderThan ago.
+func (h *Handler) purgeSearchCache(rw http.ResponseWriter, r *http.Request) {
+
+	olderThan, ok := durationParam(rw, r, "olderThan", 0)
+	if !ok {
+		return
+	}
+	n, err := h.p.PurgeSearchCache(r.Context(), r.URL.Query().Get("backend"), time.Now().Add(-olderThan))
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, purgeResponse{Purged: n})
+}
+
+func (h *Handler) listItems(rw http.ResponseWriter, r *http.Request) {
+
+	limit, ok := limitParam(rw, r, 100)
+	if !ok {
+		return
+	}
+	offset, ok := intParam(rw, r, "offset", 0)
+	if !ok {
+		return
+	}
+	res, err := h.p.RecentItems(r.Context(), proxy.RecentFeedItemsQuery{
+		Indexers:   listParam(r, "backend"),
+		Categories: listParam(r, "cat"),
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+func (h *Handler) listGrabs(rw http.ResponseWriter, r *http.Request) {
+
+	limit, ok := limitParam(rw, r, 100)
+	if !ok {
+		return
+	}
+	offset, ok := intParam(rw, r, "offset", 0)
+	if !ok {
+		return
+	}
+	since, ok := durationParam(rw, r, "since", 0)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	gq := proxy.GrabQuery{
+		IndexerName: q.Get("backend"),
+		FeedItemID:  q.Get("item"),
+		APIKey:      q.Get("key"),
+		Title:       q.Get("title"),
+		Limit:       limit,
+		Offset:      offset,
+	}
+	if since > 0 {
+		gq.Since = time.Now().Add(-since)
+	}
+	switch q.Get("outcome") {
+	case "":
+	case "ok":
+		gq.Succeeded = lo.ToPtr(true)
+	case "failed":
+		gq.Succeeded = lo.ToPtr(false)
+	default:
+		respondError(rw, http.StatusBadRequest, "outcome must be ok or failed")
+		return
+	}
+	res, err := h.p.Grabs(r.Context(), gq)
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// grabStats summarises grabs by backend over the last day, or the duration
+// given by since, optionally only those made with one API key.
+func (h *Handler) grabStats(rw http.ResponseWriter, r *http.Request) {
+
+	since, ok := durationParam(rw, r, "since", 24*time.Hour)
+	if !ok {
+		return
+	}
+	res, err := h.p.GrabStats(r.Context(), time.Now().Add(-since), r.URL.Query().Get("key"))
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// checkGrabbed reports whether the release given by the id or title
+// parameter has been grabbed before.
+func (h *Handler) checkGrabbed(rw http.ResponseWriter, r *http.Request) {
+
+	id, title := r.URL.Query().Get("id"), r.URL.Query().Get("title")
+	if id == "" && title == "" {
+		respondError(rw, http.StatusBadRequest, "id or title must be given")
+		return
+	}
+	res, err := h.p.ReleaseGrabs(r.Context(), id, title)
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+func (h *Handler) listSearchLog(rw http.ResponseWriter, r *http.Request) {
+
+	limit, ok := limitParam(rw, r, 100)
+	if !ok {
+		return
+	}
+	offset, ok := intParam(rw, r, "offset", 0)
+	if !ok {
+		return
+	}
+	since, ok := durationParam(rw, r, "since", 0)
+	if !ok {
+		return
+	}
+	sq := proxy.SearchLogQuery{
+		Query:  r.URL.Query().Get("query"),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if since > 0 {
+		sq.Since = time.Now().Add(-since)
+	}
+	res, err := h.p.SearchLog(r.Context(), sq)
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// topQueries lists the queries searched for most often over the last week,
+// or the duration given by since.
+func (h *Handler) topQueries(rw http.ResponseWriter, r *http.Request) {
+
+	h.queryStats(rw, r, h.p.TopQueries)
+}
+
+// zeroResultQueries lists the queries that never returned anything over
+// the last week, or the duration given by since.
+func (h *Handler) zeroResultQueries(rw http.ResponseWriter, r *http.Request) {
+
+	h.queryStats(rw, r, h.p.ZeroResultQueries)
+}
+
+func (h *Handler) queryStats(rw http.ResponseWriter, r *http.Request, list func(context.Context, time.Time, int) ([]proxy.QueryStats, error)) {
+
+	limit, ok := limitParam(rw, r, 50)
+	if !ok {
+		return
+	}
+	since, ok := durationParam(rw, r, "since", 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	res, err := list(r.Context(), time.Now().Add(-since), limit)
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// backendContributions summarises how each backend contributed to searches
+// over the last week, or the duration given by since.
+func (h *Handler) backendContributions(rw http.ResponseWriter, r *http.Request) {
+
+	since, ok := durationParam(rw, r, "since", 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	res, err := h.p.BackendContributions(r.Context(), time.Now().Add(-since))
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// prune deletes expired items now, rather than waiting for the next
+// scheduled run.
+func (h *Handler) prune(rw http.ResponseWriter, r *http.Request) {
+
+	res, err := h.p.Prune(r.Context())
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+func (h *Handler) checkSearchIndex(rw http.ResponseWriter, r *http.Request) {
+
+	res, err := h.p.CheckSearchIndex(r.Context())
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(rw, res)
+}
+
+// rebuildSearchIndex rebuilds the search index, responding with its status
+// afterwards.
+func (h *Handler) rebuildSearchIndex(rw http.ResponseWriter, r *http.Request) {
+
+	err := h.p.RebuildSearchIndex(r.Context())
+	if err != nil {
+		respondError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.checkSearchIndex(rw, r)
+}
+
+// listParam reads a comma-delimited query parameter.
+func listParam(r *http.Request, name string) []string {
+
+	var ret []string
+	for _, v := range strings.Split(r.URL.Query().Get(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// intParam reads an optional integer query parameter, responding with an
+// error and returning false if it is malformed.
+func intParam(rw http.ResponseWriter, r *http.Request, name string, def int) (int, bool) {
+
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		respondError(rw, http.StatusBadRequest, name+" must be an integer")
+		return 0, false
+	}
+	return v, true
+}
+
+// maxLimit caps the number of rows a list request can ask for.
+const maxLimit = 1000
+
+// limitParam reads the optional limit query parameter, capping it at
+// maxLimit. A negative limit, which would mean no limit to the store, is
+// rejected.
+func limitParam(rw http.ResponseWriter, r *http.Request, def int) (int, bool) {
+
+	v, ok := intParam(rw, r, "limit", def)
+	if !ok {
+		return 0, false
+	}
+	if v < 0 {
+		respondError(rw, http.StatusBadRequest, "limit must not be negative")
+		return 0, false
+	}
+	return min(v, maxLimit), true
+}
+
+// durationParam reads an optional duration query parameter, responding with
+// an error and returning false if it is malformed.
+func durationParam(rw http.ResponseWriter, r *http.Request, name string, def time.Duration) (time.Duration, bool) {
+
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		respondError(rw, http.StatusBadRequest, name+" must be a duration, e.g. 24h")
+		return 0, false
+	}
+	return v, true
+}
+
+func respondJSON(rw http.ResponseWriter, v any) {
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(v)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func respondError(rw http.ResponseWriter, code int, msg string) {
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(errorResponse{Error: msg})
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/proxy"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+func newTabWriter() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func searchCmd() *cobra.Command {
+
+	var params newznab.SearchParams
+	cmd := &cobra.Command{
+		Use:   "search QUERY",
+		Short: "Run a search through the proxy, as a newznab client would",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_, prox, err := openProxy(ctx)
+			if err != nil {
+				return err
+			}
+			params.Query = strings.Join(args, " ")
+			feed, err := prox.Search(ctx, params)
+			if err != nil {
+				return err
+			}
+			w := newTabWriter()
+			fmt.Fprintln(w, "ID\tSIZE\tPOSTED\tTITLE")
+			for _, item := range feed.Channel.Items {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", itemID(item), humanize.Bytes(uint64(max(item.Enclosure.Length, 0))),
+					humanize.Time(time.Time(item.PubDate)), item.Title)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&params.Category, "cat", "", "comma-separated categories to search")
+	cmd.Flags().IntVar(&params.Limit, "limit", 0, "maximum number of results")
+	cmd.Flags().StringVar(&params.Sort, "sort", "", "sort order, e.g. size_desc")
+	return cmd
+}
+
+// itemID returns the proxy's ID for item, the last segment of its NZB link.
+func itemID(item newznab.Item) string {
+
+	u, err := url.Parse(item.Enclosure.URL)
+	if err != nil {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+func grabCmd() *cobra.Command {
+
+	var output string
+	cmd := &cobra.Command{
+		Use:   "grab ID",
+		Short: "Download the NZB of a stored item",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_, prox, err := openProxy(ctx)
+			if err != nil {
+				return err
+			}
+			nzb, err := prox.GetNZB(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if output == "-" {
+				_, err = os.Stdout.Write(nzb.Data)
+				return err
+			}
+			if output == "" {
+				output = strings.ReplaceAll(nzb.Filename, "/", "_")
+			}
+			err = os.WriteFile(output, nzb.Data, 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %s (%s)\n", output, humanize.Bytes(uint64(len(nzb.Data))))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write to, or - for stdout (default: the NZB's name)")
+	return cmd
+}
+
+func pollCmd() *cobra.Command {
+
+	return &cobra.Command{
+		Use:   "poll BACKEND FEED",
+		Short: "Poll an RSS feed once, now",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_, prox, err := openProxy(ctx)
+			if err != nil {
+				return err
+			}
+			run, err := prox.PollFeed(ctx, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Polled %s/%s in %s: %d items seen, %d new\n", args[0], args[1],
+				run.FinishedAt.Sub(run.StartedAt), run.ItemsSeen, run.ItemsNew)
+			return nil
+		},
+	}
+}
+
+func migrateCmd() *cobra.Command {
+
+	printStatuses := func(cmd *cobra.Command, dbPath string) error {
+		statuses, err := proxy.MigrationStatuses(cmd.Context(), dbPath)
+		if err != nil {
+			return err
+		}
+		w := newTabWriter()
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, s := range statuses {
+			status := "pending"
+			switch {
+			case s.Modified:
+				status = "modified since applied"
+			case s.Applied:
+				status = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, status)
+		}
+		return w.Flush()
+	}
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply any pending database migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			s, err := proxy.NewStore(cmd.Context(), cfg.Storage.DBPath)
+			if err != nil {
+				return err
+			}
+			s.Close()
+			return printStatuses(cmd, cfg.Storage.DBPath)
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they have been applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			return printStatuses(cmd, cfg.Storage.DBPath)
+		},
+	})
+	return cmd
+}
+
+func dbCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Inspect the database",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Show row counts and the size of the database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			s, err := proxy.NewStore(cmd.Context(), cfg.Storage.DBPath)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			stats, err := s.GetDBStats(cmd.Context())
+			if err != nil {
+				return err
+			}
+			w := newTabWriter()
+			if fi, err := os.Stat(cfg.Storage.DBPath); err == nil {
+				fmt.Fprintf(w, "Database\t%s (%s)\n", cfg.Storage.DBPath, humanize.Bytes(uint64(fi.Size())))
+			}
+			fmt.Fprintf(w, "Feed items\t%d\n", stats.FeedItems)
+			for _, c := range stats.ItemsByIndexer {
+				fmt.Fprintf(w, "  %s (%s)\t%d\n", c.IndexerName, c.Source, c.Items)
+			}
+			fmt.Fprintf(w, "Feed item attrs\t%d\n", stats.FeedItemMeta)
+			fmt.Fprintf(w, "Search cache entries\t%d\n", stats.SearchCacheEntries)
+			fmt.Fprintf(w, "Feed poll runs\t%d\n", stats.FeedPollRuns)
+			fmt.Fprintf(w, "API keys\t%d\n", stats.APIKeys)
+			return w.Flush()
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "prune",
+		Short: "Delete items that have outlived the retention config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, prox, err := openProxy(cmd.Context())
+			if err != nil {
+				return err
+			}
+			res, err := prox.Prune(cmd.Context())
+			if err != nil {
+				return err
+			}
+			total := 0
+			for _, c := range res.Items {
+				total += c.Items
+			}
+			w := newTabWriter()
+			fmt.Fprintf(w, "Items deleted\t%d\n", total)
+			for _, c := range res.Items {
+				fmt.Fprintf(w, "  %s (%s)\t%d\n", c.IndexerName, c.Source, c.Items)
+			}
+			fmt.Fprintf(w, "Search cache entries\t%d\n", res.SearchCacheEntries)
+			return w.Flush()
+		},
+	})
+	printIndexStatus := func(status proxy.SearchIndexStatus) error {
+		fmt.Printf("%d items, %d indexed\n", status.Items, status.Indexed)
+		if !status.OK {
+			return fmt.Errorf("search index is inconsistent, run db rebuild-index to fix it: %s", status.Error)
+		}
+		fmt.Println("Search index OK")
+		return nil
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "check-index",
+		Short: "Check the search index against the stored items",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			status, err := s.CheckSearchIndex(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printIndexStatus(status)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rebuild-index",
+		Short: "Rebuild the search index from the stored items",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			err = s.RebuildSearchIndex(cmd.Context())
+			if err != nil {
+				return err
+			}
+			status, err := s.CheckSearchIndex(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printIndexStatus(status)
+		},
+	})
+	return cmd
+}
+
+func cacheCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the search cache",
+	}
+	var indexer string
+	var olderThan time.Duration
+	purge := &cobra.Command{
+		Use:   "purge",
+		Short: "Forget cached search outcomes, so the searches are retried",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			n, err := s.DeleteSearchCacheEntries(cmd.Context(), indexer, time.Now().Add(-olderThan))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Purged %d search cache entries\n", n)
+			return nil
+		},
+	}
+	purge.Flags().StringVar(&indexer, "backend", "", "only purge entries for this backend")
+	purge.Flags().DurationVar(&olderThan, "older-than", 0, "only purge entries last tried at least this long ago")
+	cmd.AddCommand(purge)
+	return cmd
+}
+
+func keysCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage API keys",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create NAME",
+		Short: "Create an API key, printing it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			key := proxy.NewAPIKey(args[0])
+			err = s.InsertAPIKey(cmd.Context(), key)
+			if err != nil {
+				return err
+			}
+			fmt.Println(key.Key)
+			return nil
+		},
+	}, &cobra.Command{
+		Use:   "revoke KEY|NAME",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			err = s.RevokeAPIKey(cmd.Context(), args[0], time.Now())
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("no active key %s", args[0])
+			}
+			return err
+		},
+	}, &cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			keys, err := s.ListAPIKeys(cmd.Context())
+			if err != nil {
+				return err
+			}
+			w := newTabWriter()
+			fmt.Fprintln(w, "NAME\tKEY\tCREATED\tREVOKED")
+			for _, k := range keys {
+				revoked := "-"
+				if k.RevokedAt != nil {
+					revoked = k.RevokedAt.Format(time.DateTime)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.Name, k.Key, k.CreatedAt.Format(time.DateTime), revoked)
+			}
+			return w.Flush()
+		},
+	})
+	return cmd
+}
+
+func grabsCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "grabs",
+		Short: "Inspect the history of NZBs grabbed through the proxy",
+	}
+
+	var q proxy.GrabQuery
+	var since time.Duration
+	var outcome string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List grabs, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch outcome {
+			case "":
+			case "ok":
+				q.Succeeded = lo.ToPtr(true)
+			case "failed":
+				q.Succeeded = lo.ToPtr(false)
+			default:
+				return fmt.Errorf("--outcome must be ok or failed")
+			}
+			if since > 0 {
+				q.Since = time.Now().Add(-since)
+			}
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			grabs, err := s.ListGrabs(cmd.Context(), q)
+			if err != nil {
+				return err
+			}
+			return printGrabs(grabs)
+		},
+	}
+	list.Flags().StringVar(&q.IndexerName, "backend", "", "only list grabs from this backend")
+	list.Flags().StringVar(&q.FeedItemID, "item", "", "only list grabs of this item")
+	list.Flags().StringVar(&q.APIKey, "key", "", "only list grabs made with this API key or key name")
+	list.Flags().StringVar(&q.Title, "title", "", "only list grabs whose title contains this")
+	list.Flags().StringVar(&outcome, "outcome", "", "only list grabs that succeeded (ok) or failed (failed)")
+	list.Flags().DurationVar(&since, "since", 0, "only list grabs made within this long")
+	list.Flags().IntVar(&q.Limit, "limit", 50, "maximum number of grabs to list")
+
+	var statsSince time.Duration
+	var statsKey string
+	stats := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarise grabs by backend",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := openStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			stats, err := s.GetGrabStats(cmd.Context(), time.Now().Add(-statsSince), statsKey)
+			if err != nil {
+				return err
+			}
+			w := newTabWriter()
+			fmt.Fprintln(w, "BACKEND\tGRABS\tFAILED\tSIZE\tLAST")
+			for _, st := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", st.IndexerName, st.Grabs, st.Failed,
+					humanize.Bytes(uint64(st.Bytes)), st.LastGrabbed.Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+	stats.Flags().DurationVar(&statsSince, "since", 24*time.Hour, "summarise grabs made within this long")
+	stats.Flags().StringVar(&statsKey, "key", "", "only count grabs made with this API key or key name")
+
+	var title string
+	check := &cobra.Command{
+		Use:   "check [ID]",
+		Short: "Report whether a release has been grabbed before, by item ID or --title",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var id string
+			if len(args) > 0 {
+				id = args[0]
+			}
+			if id == "" && title == "" {
+				return fmt.Errorf("an item ID or --title is required")
+			}
+			_, prox, err := openProxy(cmd.Context())
+			if err != nil {
+				return err
+			}
+			res, err := prox.ReleaseGrabs(cmd.Context(), id, title)
+			if err != nil {
+				return err
+			}
+			if res.Grabbed {
+				fmt.Println("Already grabbed")
+			} else {
+				fmt.Println("Not grabbed")
+			}
+			if len(res.Grabs) == 0 {
+				return nil
+			}
+			return printGrabs(res.Grabs)
+		},
+	}
+	check.Flags().StringVar(&title, "title", "", "release title to look for")
+
+	cmd.AddCommand(list, stats, check)
+	return cmd
+}
+
+func printGrabs(grabs []proxy.Grab) error {
+
+	w := newTabWriter()
+	fmt.Fprintln(w, "TIME\tBACKEND\tKEY\tSIZE\tID\tTITLE\tERROR")
+	for _, g := range grabs {
+		key := cmp.Or(g.APIKeyName, g.APIKey, "-")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", g.GrabbedAt.Format(time.DateTime), g.IndexerName, key,
+			humanize.Bytes(uint64(g.Size)), g.FeedItemID, g.Title, cmp.Or(g.Error, "-"))
+	}
+	return w.Flush()
+}
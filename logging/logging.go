@@ -0,0 +1,108 @@
+// Package logging sets up structured logging, carrying request IDs in the
+// context and keeping API keys out of the logs.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+var apiKeyParam = regexp.MustCompile(`(?i)(apikey=)[^&\s"']*`)
+
+// Redact replaces the value of any apikey query parameter in s.
+func Redact(s string) string {
+	return apiKeyParam.ReplaceAllString(s, "${1}"+redacted)
+}
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the ID of the request
+// being served, which is added to any records logged with it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	v, _ := ctx.Value(requestIDContextKey{}).(string)
+	return v
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ParseLevel parses a level name such as "debug" or "warn", defaulting to
+// info if s is empty.
+func ParseLevel(s string) (slog.Level, error) {
+
+	var ret slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := ret.UnmarshalText([]byte(s))
+	return ret, err
+}
+
+// NewHandler returns a handler writing records to w in format, either "text"
+// (the default) or "json".
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %s", format)
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+
+	if strings.EqualFold(a.Key, "apikey") {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// contextHandler adds the request ID from the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
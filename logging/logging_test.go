@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+
+	assert.Equal(t, "/api?t=search&apikey=REDACTED&q=x", Redact("/api?t=search&apikey=secret&q=x"))
+	assert.Equal(t, `Get "http://a/api?APIKEY=REDACTED": refused`, Redact(`Get "http://a/api?APIKEY=secret": refused`))
+	assert.Equal(t, "no key here", Redact("no key here"))
+}
+
+func TestHandler(t *testing.T) {
+
+	var buf bytes.Buffer
+	h, err := NewHandler(&buf, "json", slog.LevelInfo)
+	require.NoError(t, err)
+	log := slog.New(h)
+
+	ctx := ContextWithRequestID(context.Background(), "abc")
+	log.InfoContext(ctx, "request", "url", "/rss?apikey=secret", "apikey", "secret",
+		"err", errors.New(`Get "/api?apikey=secret"`))
+	assert.NotContains(t, buf.String(), "secret")
+	assert.Contains(t, buf.String(), `"request_id":"abc"`)
+
+	buf.Reset()
+	log.DebugContext(ctx, "hidden")
+	assert.Empty(t, buf.String())
+
+	_, err = NewHandler(&buf, "xml", slog.LevelInfo)
+	assert.Error(t, err)
+}
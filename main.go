@@ -3,78 +3,112 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	_ "time/tzdata"
 
-	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/logging"
 	"github.com/henges/newznab-proxy/proxy"
+	"github.com/spf13/cobra"
 )
 
+var configPath string
+
+// logLevel is shared by the default logger, so reloading the config can
+// change it.
+var logLevel = new(slog.LevelVar)
+
 func main() {
 
-	ctx := context.Background()
-	cfg := proxy.MustGetConfig()
-	prox, err := proxy.NewProxy(ctx, cfg)
-	if err != nil {
-		log.Fatal(err)
-		return
+	root := &cobra.Command{
+		Use:          "newznab-proxy",
+		Short:        "A caching proxy in front of newznab indexers",
+		SilenceUsage: true,
+		// Serving is the default, as it was the only thing the binary did.
+		RunE: runServe,
+	}
+	root.PersistentFlags().StringVarP(&configPath, "config", "c", proxy.ConfigPath(), "path to the config file")
+	root.AddCommand(
+		serveCmd(),
+		validateConfigCmd(),
+		searchCmd(),
+		grabCmd(),
+		pollCmd(),
+		migrateCmd(),
+		dbCmd(),
+		cacheCmd(),
+		keysCmd(),
+		grabsCmd(),
+	)
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		os.Exit(1)
 	}
-	prox.StartRSSPolls(ctx)
-
-	srv := newznab.NewServer(prox, newznab.WithAPIKeyValidation(func() ([]string, error) {
-		return []string{"0"}, nil
-	}), newznab.WithMiddleware(func(handler http.Handler) http.Handler {
-		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-			lmw := &loggingMiddleware{rw, 0}
-			handler.ServeHTTP(lmw, r)
-			dur := time.Since(start)
-			if r.URL.Path == "/healthz" || r.URL.Path == "/favicon.ico" {
-				return
+}
+
+func validateConfigCmd() *cobra.Command {
+
+	return &cobra.Command{
+		Use:   "validate-config",
+		Short: "Report any problems with the config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := proxy.LoadConfig(configPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", configPath, err)
 			}
-			log.Printf("%s %s %d %s", r.Method, r.URL, lmw.statusCode, dur)
-		})
-	}))
-	hsrv := http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.Web.ListenAddr, cfg.Web.Port),
-		Handler: srv.Handler(),
+			fmt.Printf("%s: OK\n", configPath)
+			return nil
+		},
 	}
-	go func() {
-		hsrv.ListenAndServe()
-	}()
-	fmt.Println("Server up")
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	<-ch
-
-	err = hsrv.Shutdown(ctx)
+}
+
+// loadConfig loads the config and sets up logging as it describes.
+func loadConfig() (*proxy.Config, error) {
+
+	cfg, err := proxy.LoadConfig(configPath)
 	if err != nil {
-		log.Printf("Error shutting down http server: %s", err)
+		return nil, err
 	}
-	err = prox.StopRSSPolls()
+	h, err := logging.NewHandler(os.Stderr, cfg.Log.Format, logLevel)
 	if err != nil {
-		log.Printf("Error shutting down RSS polls: %s", err)
+		return nil, err
 	}
+	slog.SetDefault(slog.New(h))
+	return cfg, applyLogLevel(cfg)
 }
 
-type loggingMiddleware struct {
-	d          http.ResponseWriter
-	statusCode int
-}
+func applyLogLevel(cfg *proxy.Config) error {
 
-func (l *loggingMiddleware) Header() http.Header {
-	return l.d.Header()
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+	return nil
 }
 
-func (l *loggingMiddleware) Write(bytes []byte) (int, error) {
-	return l.d.Write(bytes)
+// openProxy loads the config and creates a proxy from it, without starting
+// any pollers.
+func openProxy(ctx context.Context) (*proxy.Config, *proxy.Proxy, error) {
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	prox, err := proxy.NewProxy(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, prox, nil
 }
 
-func (l *loggingMiddleware) WriteHeader(statusCode int) {
-	l.statusCode = statusCode
-	l.d.WriteHeader(statusCode)
+// openStore loads the config and opens the store it names, applying any
+// pending migrations.
+func openStore(ctx context.Context) (*proxy.Store, error) {
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return proxy.NewStore(ctx, cfg.Storage.DBPath)
 }
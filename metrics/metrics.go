@@ -0,0 +1,137 @@
+// Package metrics holds the Prometheus metrics exported by the proxy.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "newznab_proxy"
+
+// Registry holds every metric below, along with the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Requests served, by endpoint (the t parameter for /api) and status code.
+var (
+	Requests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests served, by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve requests, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+)
+
+// Requests made to backends, by backend, request type and outcome.
+var (
+	BackendRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_requests_total",
+		Help:      "Requests made to backends, by backend, request type and outcome.",
+	}, []string{"backend", "type", "outcome"})
+	BackendRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backend_request_duration_seconds",
+		Help:      "Time taken for backends to respond, by backend and request type.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"backend", "type"})
+	BackendSearchResults = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_search_results_total",
+		Help:      "Items returned by backend searches.",
+	}, []string{"backend"})
+)
+
+// Searches answered from stored items or sent to backends, and how the search
+// cache affected each backend.
+var (
+	Searches = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searches_total",
+		Help:      "Searches, by whether they were answered from stored items (local) or backends (remote).",
+	}, []string{"source"})
+	SearchCache = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "search_cache_total",
+		Help:      "Backend search outcomes recorded in the search cache (hit, miss, error), or skip if the cache prevented the search.",
+	}, []string{"backend", "result"})
+)
+
+// RSS polls, by backend and feed.
+var (
+	Polls = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rss_polls_total",
+		Help:      "RSS polls, by backend, feed and outcome.",
+	}, []string{"backend", "feed", "outcome"})
+	PollDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rss_poll_duration_seconds",
+		Help:      "Time taken to poll RSS feeds, including catch-up pages.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"backend", "feed"})
+	PollNewItems = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rss_poll_new_items_total",
+		Help:      "New items stored by RSS polls.",
+	}, []string{"backend", "feed"})
+)
+
+// NZBs fetched for clients, by backend.
+var (
+	Grabs = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grabs_total",
+		Help:      "NZB grabs, by backend and outcome.",
+	}, []string{"backend", "outcome"})
+	GrabBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grab_bytes_total",
+		Help:      "Bytes of NZBs grabbed, by backend.",
+	}, []string{"backend"})
+)
+
+// Retention runs, which delete expired items.
+var (
+	Prunes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prunes_total",
+		Help:      "Retention runs, by outcome.",
+	}, []string{"outcome"})
+	PrunedItems = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pruned_items_total",
+		Help:      "Expired items deleted, by backend and source.",
+	}, []string{"backend", "source"})
+)
+
+// Outcome returns the outcome label for err.
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,83 @@
+package newznab
+
+import (
+	"encoding/xml"
+)
+
+type Caps struct {
+	XMLName    xml.Name       `xml:"caps"`
+	Server     CapsServer     `xml:"server"`
+	Limits     CapsLimits     `xml:"limits"`
+	Searching  CapsSearching  `xml:"searching"`
+	Categories []CapsCategory `xml:"categories>category"`
+}
+
+type CapsServer struct {
+	Version string `xml:"version,attr,omitempty"`
+	Title   string `xml:"title,attr,omitempty"`
+}
+
+type CapsLimits struct {
+	Max     int `xml:"max,attr"`
+	Default int `xml:"default,attr"`
+}
+
+type CapsSearching struct {
+	Search      CapsSearch `xml:"search"`
+	TVSearch    CapsSearch `xml:"tv-search"`
+	MovieSearch CapsSearch `xml:"movie-search"`
+}
+
+type CapsSearch struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr,omitempty"`
+}
+
+func NewCapsSearch(available bool, params string) CapsSearch {
+
+	ret := CapsSearch{Available: "no", SupportedParams: params}
+	if available {
+		ret.Available = "yes"
+	}
+	return ret
+}
+
+type CapsCategory struct {
+	ID      string       `xml:"id,attr"`
+	Name    string       `xml:"name,attr"`
+	Subcats []CapsSubcat `xml:"subcat"`
+}
+
+type CapsSubcat struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+// StandardCategories are the categories defined by the newznab spec.
+var StandardCategories = []CapsCategory{
+	{ID: "1000", Name: "Console", Subcats: []CapsSubcat{
+		{"1010", "NDS"}, {"1020", "PSP"}, {"1030", "Wii"}, {"1040", "XBox"}, {"1050", "XBox 360"},
+		{"1060", "Wiiware"}, {"1070", "XBox 360 DLC"}, {"1080", "PS3"},
+	}},
+	{ID: "2000", Name: "Movies", Subcats: []CapsSubcat{
+		{"2010", "Foreign"}, {"2020", "Other"}, {"2030", "SD"}, {"2040", "HD"}, {"2045", "UHD"},
+		{"2050", "BluRay"}, {"2060", "3D"},
+	}},
+	{ID: "3000", Name: "Audio", Subcats: []CapsSubcat{
+		{"3010", "MP3"}, {"3020", "Video"}, {"3030", "Audiobook"}, {"3040", "Lossless"},
+	}},
+	{ID: "4000", Name: "PC", Subcats: []CapsSubcat{
+		{"4010", "0day"}, {"4020", "ISO"}, {"4030", "Mac"}, {"4040", "Mobile-Other"}, {"4050", "Games"},
+		{"4060", "Mobile-iOS"}, {"4070", "Mobile-Android"},
+	}},
+	{ID: "5000", Name: "TV", Subcats: []CapsSubcat{
+		{"5020", "Foreign"}, {"5030", "SD"}, {"5040", "HD"}, {"5045", "UHD"}, {"5050", "Other"},
+		{"5060", "Sport"}, {"5070", "Anime"}, {"5080", "Documentary"},
+	}},
+	{ID: "6000", Name: "XXX", Subcats: []CapsSubcat{
+		{"6010", "DVD"}, {"6020", "WMV"}, {"6030", "XviD"}, {"6040", "x264"},
+	}},
+	{ID: "7000", Name: "Other", Subcats: []CapsSubcat{
+		{"7010", "Misc"}, {"7020", "Ebook"}, {"7030", "Comics"},
+	}},
+}
@@ -1,14 +1,31 @@
 package newznab
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/schema"
+	"github.com/henges/newznab-proxy/logging"
+	"github.com/henges/newznab-proxy/metrics"
 	"github.com/henges/newznab-proxy/xmlutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const ua = "newznab-client/0.0.1"
@@ -18,10 +35,23 @@ type Client struct {
 	baseURL   string
 	apiKey    string
 	userAgent string
+	name      string
+
+	validatorsMu sync.Mutex
+	validators   map[string]RSSValidators
+}
+
+// RSSValidators are the cache validators of an RSS response. They take effect
+// once passed to CommitRSSValidators.
+type RSSValidators struct {
+	url          string
+	etag         string
+	lastModified string
 }
 
 type clientOptions struct {
 	userAgent string
+	name      string
 }
 
 type ClientOption func(options *clientOptions)
@@ -32,6 +62,14 @@ func WithUserAgent(s string) ClientOption {
 	}
 }
 
+// WithName sets the backend name the client's requests are recorded under in
+// metrics.
+func WithName(name string) ClientOption {
+	return func(options *clientOptions) {
+		options.name = name
+	}
+}
+
 var encoderOnce sync.Once
 var encoder *schema.Encoder
 
@@ -44,10 +82,12 @@ func NewClient(baseURL, apiKey string, opts ...ClientOption) *Client {
 	}
 
 	return &Client{
-		cl:        &http.Client{},
-		baseURL:   baseURL,
-		apiKey:    apiKey,
-		userAgent: options.userAgent,
+		cl:         &http.Client{},
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		userAgent:  options.userAgent,
+		name:       options.name,
+		validators: make(map[string]RSSValidators),
 	}
 }
 
@@ -61,63 +101,313 @@ func getEncoder() *schema.Encoder {
 
 func (c *Client) Search(ctx context.Context, params SearchParams) (*RssFeed, error) {
 
+	ctx, span := c.startSpan(ctx, "Client.Search")
+	defer span.End()
+	v, err := params.Values()
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	start := time.Now()
+	ret, err := c.getFeed(ctx, "search", v)
+	recordError(span, err)
+	c.logCall(ctx, slog.LevelInfo, "backend search", start, ret, err, slog.String("query", params.Query))
+	return ret, err
+}
+
+// logCall logs a call to the backend that returned feed.
+func (c *Client) logCall(ctx context.Context, level slog.Level, msg string, start time.Time, feed *RssFeed, err error, attrs ...slog.Attr) {
+
+	attrs = append(attrs, slog.String("backend", c.name), slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+		level = max(level, slog.LevelWarn)
+	} else if feed != nil {
+		attrs = append(attrs, slog.Int("results", len(feed.Channel.Items)))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// Details fetches the full details of the item with the indexer's id.
+func (c *Client) Details(ctx context.Context, id string) (*RssFeed, error) {
+
+	ctx, span := c.startSpan(ctx, "Client.Details")
+	defer span.End()
 	v := make(url.Values)
-	err := getEncoder().Encode(params, v)
+	v.Set("id", id)
+	ret, err := c.getFeed(ctx, "details", v)
+	recordError(span, err)
+	return ret, err
+}
+
+// GetNFO fetches the raw NFO of the item with the indexer's id.
+func (c *Client) GetNFO(ctx context.Context, id string) ([]byte, error) {
+
+	v := make(url.Values)
+	v.Set("id", id)
+	v.Set("raw", "1")
+	resp, err := c.getAPI(ctx, "getnfo", v)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	v.Set("t", "search")
+	if err := errorResponse(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// errorResponse returns the error a newznab <error> body reports, or nil if
+// data isn't one. Indexers send these with a 200 status.
+func errorResponse(data []byte) error {
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) {
+		if i := bytes.Index(trimmed, []byte("?>")); i >= 0 {
+			trimmed = bytes.TrimSpace(trimmed[i+2:])
+		}
+	}
+	if !bytes.HasPrefix(trimmed, []byte("<error")) {
+		return nil
+	}
+	// The spec puts the code and description in attributes, but accept
+	// them as elements too, as ServerError marshals them.
+	var e struct {
+		Code            int    `xml:"code,attr"`
+		Description     string `xml:"description,attr"`
+		CodeElem        int    `xml:"code"`
+		DescriptionElem string `xml:"description"`
+	}
+	if err := xmlutil.Unmarshal(trimmed, &e); err != nil {
+		return nil
+	}
+	if e.Code == 0 && e.Description == "" {
+		e.Code, e.Description = e.CodeElem, e.DescriptionElem
+	}
+	return ServerError{Code: e.Code, Description: e.Description}
+}
+
+func (c *Client) getAPI(ctx context.Context, t string, v url.Values) (*http.Response, error) {
+
+	v.Set("t", t)
 	v.Set("apikey", c.apiKey)
 	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api?"+v.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
+	return c.do(req, t)
+}
+
+// StatusError is returned when an indexer responds with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e StatusError) Error() string {
+	return "unexpected response status " + e.Status
+}
+
+// ErrNotModified is returned by PollRSS when the feed is unchanged since it
+// was last fetched.
+var ErrNotModified = errors.New("not modified")
+
+// do sends req, returning a StatusError for non-2xx responses. Compressed
+// response bodies are decompressed. The request is recorded in metrics as
+// type t.
+func (c *Client) do(req *http.Request, t string) (*http.Response, error) {
+
 	req.Header.Set("User-Agent", c.userAgent)
-	resp, err := c.cl.Do(req)
+	// Setting this stops the transport from handling gzip itself, so the
+	// body is decoded below.
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	ctx, span := tracer.Start(req.Context(), "HTTP GET", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("newznab.backend", c.name),
+		attribute.String("newznab.t", t),
+		semconv.ServerAddress(req.URL.Hostname()),
+	))
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	start := time.Now()
+	resp, err := c.cl.Do(req.WithContext(ctx))
+	metrics.BackendRequestDuration.WithLabelValues(c.name, t).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.BackendRequests.WithLabelValues(c.name, t, "error").Inc()
+		// The URL includes the API key, and errors end up in logs and the
+		// search cache.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = logging.Redact(urlErr.URL)
+		}
+		recordError(span, err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-	var ret RssFeed
-	err = xmlutil.NewDecoder(resp.Body).Decode(&ret)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	outcome := "ok"
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		outcome = "not_modified"
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		outcome = "error"
+	}
+	metrics.BackendRequests.WithLabelValues(c.name, t, outcome).Inc()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotModified {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		return nil, StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := decodeBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case "deflate":
+		// Deflate should be zlib-wrapped, but some servers send raw deflate.
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		} else {
+			r = flate.NewReader(br)
+		}
+	default:
+		return nil, errors.New("unsupported content encoding " + resp.Header.Get("Content-Encoding"))
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return readCloser{Reader: r, Closer: resp.Body}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (c *Client) getFeed(ctx context.Context, t string, v url.Values) (*RssFeed, error) {
+
+	resp, err := c.getAPI(ctx, t, v)
 	if err != nil {
 		return nil, err
 	}
-	return &ret, nil
+	defer resp.Body.Close()
+	return decodeFeed(ctx, resp.Body)
+}
+
+// PollRSS fetches an RSS feed. The request is conditional on the validators
+// last committed for the same path and params, and ErrNotModified is returned
+// if the indexer reports that the feed has not changed. The validators of the
+// response are returned for the caller to commit once it has handled the
+// feed, so that a feed that fails to be handled is fetched in full next time.
+func (c *Client) PollRSS(ctx context.Context, rssPath string, params map[string]string) (*RssFeed, RSSValidators, error) {
+
+	ctx, span := c.startSpan(ctx, "Client.PollRSS")
+	defer span.End()
+	start := time.Now()
+	ret, v, err := c.pollRSS(ctx, rssPath, params)
+	if errors.Is(err, ErrNotModified) {
+		c.logCall(ctx, slog.LevelDebug, "backend rss poll not modified", start, nil, nil, slog.String("path", rssPath))
+		return ret, v, err
+	}
+	recordError(span, err)
+	c.logCall(ctx, slog.LevelDebug, "backend rss poll", start, ret, err, slog.String("path", rssPath))
+	return ret, v, err
+}
+
+// CommitRSSValidators makes later polls of the same feeds conditional on vs.
+func (c *Client) CommitRSSValidators(vs ...RSSValidators) {
+
+	c.validatorsMu.Lock()
+	defer c.validatorsMu.Unlock()
+	for _, v := range vs {
+		if v.url != "" {
+			c.validators[v.url] = v
+		}
+	}
 }
 
-func (c *Client) PollRSS(ctx context.Context, rssPath string, params map[string]string) (*RssFeed, error) {
+func (c *Client) pollRSS(ctx context.Context, rssPath string, params map[string]string) (*RssFeed, RSSValidators, error) {
 
 	qp := make(url.Values, len(params))
 	for k, v := range params {
 		qp.Set(k, v)
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/"+rssPath+"?"+qp.Encode(), nil)
+	u := c.baseURL + "/" + rssPath + "?" + qp.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
-		return nil, err
+		return nil, RSSValidators{}, err
 	}
-	req.Header.Set("User-Agent", c.userAgent)
-	resp, err := c.cl.Do(req)
+	c.validatorsMu.Lock()
+	prev := c.validators[u]
+	c.validatorsMu.Unlock()
+	if prev.etag != "" {
+		req.Header.Set("If-None-Match", prev.etag)
+	}
+	if prev.lastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+	resp, err := c.do(req, "rss")
 	if err != nil {
-		return nil, err
+		var statusErr StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotModified {
+			return nil, RSSValidators{}, ErrNotModified
+		}
+		return nil, RSSValidators{}, err
 	}
 	defer resp.Body.Close()
-	var ret RssFeed
-	err = xmlutil.NewDecoder(resp.Body).Decode(&ret)
+	ret, err := decodeFeed(ctx, resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, RSSValidators{}, err
 	}
-	return &ret, nil
+	return ret, RSSValidators{
+		url:          u,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
 }
 
 func (c *Client) GetNZB(ctx context.Context, fullURL string) ([]byte, error) {
 
+	start := time.Now()
+	b, err := c.getNZB(ctx, fullURL)
+	c.logCall(ctx, slog.LevelInfo, "backend grab", start, nil, err, slog.Int("bytes", len(b)))
+	return b, err
+}
+
+func (c *Client) getNZB(ctx context.Context, fullURL string) ([]byte, error) {
+
 	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", c.userAgent)
-	resp, err := c.cl.Do(req)
+	resp, err := c.do(req, "getnzb")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,101 @@
+package newznab
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_PollRSSConditional(t *testing.T) {
+
+	body, err := xmlutil.Marshal(NewRssFeedFromItems(0, 1, []Item{{Title: "a", GUID: RssGuid{Value: "1"}}}))
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("ETag", `"v1"`)
+		rw.Write(body)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "k")
+	feed, v, err := c.PollRSS(context.Background(), "rss", map[string]string{"t": "5000"})
+	require.NoError(t, err)
+	assert.Equal(t, "a", feed.Channel.Items[0].Title)
+	// Validators only apply once committed.
+	_, _, err = c.PollRSS(context.Background(), "rss", map[string]string{"t": "5000"})
+	assert.NoError(t, err)
+	c.CommitRSSValidators(v)
+	_, _, err = c.PollRSS(context.Background(), "rss", map[string]string{"t": "5000"})
+	assert.ErrorIs(t, err, ErrNotModified)
+	// Validators are kept per URL.
+	_, _, err = c.PollRSS(context.Background(), "rss", map[string]string{"t": "2000"})
+	assert.NoError(t, err)
+}
+
+func TestClient_DecodesCompressedBodies(t *testing.T) {
+
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+	body, err := xmlutil.Marshal(NewRssFeedFromItems(0, 1, []Item{{Title: "a", GUID: RssGuid{Value: "1"}}}))
+	require.NoError(t, err)
+	for name, enc := range encoders {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "gzip, deflate", r.Header.Get("Accept-Encoding"))
+				var buf bytes.Buffer
+				w := enc(&buf)
+				w.Write(body)
+				w.Close()
+				if name == "gzip" {
+					rw.Header().Set("Content-Encoding", "gzip")
+				} else {
+					rw.Header().Set("Content-Encoding", "deflate")
+				}
+				rw.Write(buf.Bytes())
+			}))
+			defer srv.Close()
+
+			feed, _, err := NewClient(srv.URL, "k").PollRSS(context.Background(), "rss", nil)
+			require.NoError(t, err)
+			assert.Equal(t, "a", feed.Channel.Items[0].Title)
+		})
+	}
+}
+
+func TestClient_GetNFOError(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") == "missing" {
+			rw.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<error code="300" description="No such item"/>`))
+			return
+		}
+		rw.Write([]byte("some nfo"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "k")
+	data, err := c.GetNFO(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, "some nfo", string(data))
+	_, err = c.GetNFO(context.Background(), "missing")
+	assert.Equal(t, ServerError{Code: 300, Description: "No such item"}, err)
+}
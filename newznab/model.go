@@ -158,3 +158,8 @@ type NZB struct {
 	Filename string
 	Data     []byte
 }
+
+type NFO struct {
+	Title string
+	Data  []byte
+}
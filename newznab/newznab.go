@@ -4,12 +4,34 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"net/url"
 	"strings"
 )
 
 type ServerImplementation interface {
 	Search(ctx context.Context, params SearchParams) (*RssFeed, error)
 	GetNZB(ctx context.Context, id string) (NZB, error)
+	// Details returns a feed containing the single item with id, including
+	// all of its attributes.
+	Details(ctx context.Context, id string) (*RssFeed, error)
+	GetNFO(ctx context.Context, id string) (NFO, error)
+	// RSS returns the newest items known to the implementation.
+	RSS(ctx context.Context, params RSSParams) (*RssFeed, error)
+	Caps(ctx context.Context) (*Caps, error)
+}
+
+type apiKeyContextKey struct{}
+
+// ContextWithAPIKey returns a copy of ctx carrying the API key of the caller.
+func ContextWithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, apiKey)
+}
+
+// APIKeyFromContext returns the API key the server received the request with,
+// or "" if there wasn't one.
+func APIKeyFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(apiKeyContextKey{}).(string)
+	return v
 }
 
 type ServerError struct {
@@ -52,6 +74,35 @@ type SearchParams struct {
 
 	// Offset is the 0-based query offset defining which part of the response we want.
 	Offset int `schema:"offset,omitempty"`
+
+	// Sort is the order results are returned in, as a field and direction
+	// such as “size_asc” or “posted_desc”.
+	Sort string `schema:"sort,omitempty"`
+}
+
+type RSSParams struct {
+	// Category is a list of categories to include, delimited by “,”
+	Category string `schema:"cat,omitempty"`
+
+	// Backend is a list of upstream backends to include, delimited by “,”
+	Backend string `schema:"backend,omitempty"`
+
+	// Limit is the upper limit for the number of items to be returned.
+	Limit int `schema:"limit,omitempty"`
+
+	// Offset is the 0-based query offset defining which part of the response we want.
+	Offset int `schema:"offset,omitempty"`
+
+	// Sort is the order results are returned in, as for SearchParams.
+	Sort string `schema:"sort,omitempty"`
+}
+
+// Values encodes the params as query parameters.
+func (s SearchParams) Values() (url.Values, error) {
+
+	v := make(url.Values)
+	err := getEncoder().Encode(s, v)
+	return v, err
 }
 
 func (s SearchParams) WithSanitisedQuery() SearchParams {
@@ -67,6 +118,7 @@ func (s SearchParams) WithSanitisedQuery() SearchParams {
 		Del:      s.Del,
 		MaxAge:   s.MaxAge,
 		Offset:   s.Offset,
+		Sort:     s.Sort,
 	}
 }
 
@@ -75,6 +127,14 @@ func (s SearchParams) Categories() []string {
 	return strings.Split(s.Category, ",")
 }
 
+// SortOrder splits a sort parameter into its field and whether it is
+// descending. The direction defaults to ascending if omitted.
+func SortOrder(sort string) (field string, desc bool) {
+
+	field, dir, _ := strings.Cut(strings.ToLower(sort), "_")
+	return field, dir == "desc"
+}
+
 func (s SearchParams) Attributes() []string {
 
 	return strings.Split(s.Attrs, ",")
@@ -14,6 +14,7 @@ type Server struct {
 	impl              ServerImplementation
 	validateAPIKey    bool
 	getAllowedAPIKeys func() ([]string, error)
+	linkSigner        *LinkSigner
 	middlewares       []Middleware
 }
 
@@ -22,6 +23,7 @@ type Middleware func(handler http.Handler) http.Handler
 type serverOptions struct {
 	middlewares       []Middleware
 	getAllowedAPIKeys func() ([]string, error)
+	linkSigner        *LinkSigner
 }
 
 type ServerOption func(options *serverOptions)
@@ -32,6 +34,14 @@ func WithAPIKeyValidation(keyProvider func() ([]string, error)) ServerOption {
 	}
 }
 
+// WithSignedLinks requires NZB downloads to carry either a valid signature from
+// signer or an allowed API key.
+func WithSignedLinks(signer *LinkSigner) ServerOption {
+	return func(options *serverOptions) {
+		options.linkSigner = signer
+	}
+}
+
 func WithMiddleware(m ...Middleware) ServerOption {
 	return func(options *serverOptions) {
 		options.middlewares = m
@@ -48,6 +58,7 @@ func NewServer(impl ServerImplementation, opts ...ServerOption) *Server {
 		impl:              impl,
 		validateAPIKey:    options.getAllowedAPIKeys != nil,
 		getAllowedAPIKeys: options.getAllowedAPIKeys,
+		linkSigner:        options.linkSigner,
 		middlewares:       options.middlewares,
 	}
 	return ret
@@ -61,8 +72,9 @@ func (s *Server) Handler() http.Handler {
 
 func (s *Server) HandlerWithMux(m *http.ServeMux) http.Handler {
 
-	m.Handle("GET /api", http.HandlerFunc(s.apiHandler))
-	m.Handle("GET /getnzb/{id}", http.HandlerFunc(s.getNZB))
+	m.Handle("GET /api", traced("Server.api", s.apiHandler))
+	m.Handle("GET /getnzb/{id}", traced("Server.getnzb", s.getNZB))
+	m.Handle("GET /rss", traced("Server.rss", s.rss))
 	var ret http.Handler = m
 	for _, middle := range s.middlewares {
 		ret = middle(ret)
@@ -87,26 +99,69 @@ func (s *Server) apiHandler(rw http.ResponseWriter, r *http.Request) {
 	}
 	apiKey := r.Form.Get("apikey")
 	if s.validateAPIKey {
-		keys, err := s.getAllowedAPIKeys()
+		ok, err := s.isAllowedAPIKey(apiKey)
 		if err != nil {
 			respondError(rw, http.StatusInternalServerError, err)
 			return
 		}
-		if !slices.Contains(keys, apiKey) {
+		if !ok {
 			respondErrorString(rw, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 	}
 
+	r = r.WithContext(ContextWithAPIKey(r.Context(), apiKey))
+
 	// Rest of the implementation is delegated to handler funcs
 	switch reqType {
+	case "caps":
+		s.caps(rw, r)
 	case "search":
 		s.search(rw, r)
+	case "get":
+		s.get(rw, r)
+	case "details":
+		s.details(rw, r)
+	case "getnfo":
+		s.getNFO(rw, r)
 	default:
 		respondErrorString(rw, http.StatusNotImplemented, fmt.Sprint("method", reqType, "not implemented"))
 	}
 }
 
+func (s *Server) isAllowedAPIKey(apiKey string) (bool, error) {
+
+	keys, err := s.getAllowedAPIKeys()
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(keys, apiKey), nil
+}
+
+// authoriseNZB accepts a signed link if the server has a signer, and otherwise
+// falls back to API key validation.
+func (s *Server) authoriseNZB(r *http.Request, id string) error {
+
+	q := r.URL.Query()
+	if s.linkSigner != nil && q.Get(linkSignatureParam) != "" {
+		return s.linkSigner.Verify(id, q)
+	}
+	if s.validateAPIKey {
+		ok, err := s.isAllowedAPIKey(q.Get("apikey"))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ServerError{Code: http.StatusUnauthorized, Description: "Unauthorized"}
+		}
+		return nil
+	}
+	if s.linkSigner != nil {
+		return ServerError{Code: http.StatusUnauthorized, Description: "link is not signed"}
+	}
+	return nil
+}
+
 func (s *Server) getNZB(rw http.ResponseWriter, r *http.Request) {
 
 	value := r.PathValue("id")
@@ -114,8 +169,23 @@ func (s *Server) getNZB(rw http.ResponseWriter, r *http.Request) {
 		respondErrorString(rw, http.StatusBadRequest, "an NZB id must be provided")
 		return
 	}
+	err := s.authoriseNZB(r, value)
+	if err != nil {
+		var srvErr ServerError
+		if errors.As(err, &srvErr) {
+			respondXML(rw, srvErr)
+			return
+		}
+		respondError(rw, http.StatusInternalServerError, err)
+		return
+	}
 
-	nzb, err := s.impl.GetNZB(r.Context(), value)
+	// A key given alongside a signature isn't checked, so it isn't passed on.
+	ctx := r.Context()
+	if q := r.URL.Query(); q.Get(linkSignatureParam) == "" {
+		ctx = ContextWithAPIKey(ctx, q.Get("apikey"))
+	}
+	nzb, err := s.impl.GetNZB(ctx, value)
 	if err != nil {
 		var srvErr ServerError
 		if errors.As(err, &srvErr) {
@@ -152,6 +222,117 @@ func (s *Server) search(rw http.ResponseWriter, r *http.Request) {
 	respondXML(rw, res)
 }
 
+func (s *Server) caps(rw http.ResponseWriter, r *http.Request) {
+
+	res, err := s.impl.Caps(r.Context())
+	if err != nil {
+		respondImplError(rw, err)
+		return
+	}
+	respondXML(rw, res)
+}
+
+func (s *Server) rss(rw http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		respondError(rw, http.StatusBadRequest, err)
+		return
+	}
+	apiKey := r.Form.Get("apikey")
+	if s.validateAPIKey {
+		ok, err := s.isAllowedAPIKey(apiKey)
+		if err != nil {
+			respondError(rw, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			respondErrorString(rw, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+	}
+	decoder.IgnoreUnknownKeys(true)
+	var p RSSParams
+	err = decoder.Decode(&p, r.Form)
+	if err != nil {
+		respondError(rw, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.impl.RSS(ContextWithAPIKey(r.Context(), apiKey), p)
+	if err != nil {
+		respondImplError(rw, err)
+		return
+	}
+	respondXML(rw, res)
+}
+
+func (s *Server) get(rw http.ResponseWriter, r *http.Request) {
+
+	id := r.Form.Get("id")
+	if id == "" {
+		respondErrorString(rw, http.StatusBadRequest, "id parameter must be provided")
+		return
+	}
+	nzb, err := s.impl.GetNZB(r.Context(), id)
+	if err != nil {
+		respondImplError(rw, err)
+		return
+	}
+	respondNZB(rw, nzb)
+}
+
+func (s *Server) details(rw http.ResponseWriter, r *http.Request) {
+
+	id := r.Form.Get("id")
+	if id == "" {
+		respondErrorString(rw, http.StatusBadRequest, "id parameter must be provided")
+		return
+	}
+	res, err := s.impl.Details(r.Context(), id)
+	if err != nil {
+		respondImplError(rw, err)
+		return
+	}
+	respondXML(rw, res)
+}
+
+func (s *Server) getNFO(rw http.ResponseWriter, r *http.Request) {
+
+	id := r.Form.Get("id")
+	if id == "" {
+		respondErrorString(rw, http.StatusBadRequest, "id parameter must be provided")
+		return
+	}
+	nfo, err := s.impl.GetNFO(r.Context(), id)
+	if err != nil {
+		respondImplError(rw, err)
+		return
+	}
+	if r.Form.Get("raw") == "1" {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(nfo.Data)
+		return
+	}
+	item := Item{
+		Title:       nfo.Title,
+		Description: string(nfo.Data),
+	}
+	respondXML(rw, NewRssFeedFromItems(0, 1, []Item{item}))
+}
+
+// respondImplError writes errors returned by the ServerImplementation, passing
+// ServerErrors through as-is.
+func respondImplError(rw http.ResponseWriter, err error) {
+
+	var srvErr ServerError
+	if errors.As(err, &srvErr) {
+		respondXML(rw, srvErr)
+		return
+	}
+	respondError(rw, http.StatusInternalServerError, err)
+}
+
 func respondXML(rw http.ResponseWriter, v any) {
 	rw.Header().Set("Content-Type", "application/xml")
 	rw.WriteHeader(http.StatusOK)
@@ -0,0 +1,73 @@
+package newznab
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	linkExpiresParam   = "exp"
+	linkSignatureParam = "sig"
+)
+
+// LinkSigner produces and verifies expiring HMAC signatures for NZB download
+// links, so that rewritten links can be handed to download clients without
+// exposing an open relay.
+type LinkSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewLinkSigner(key []byte, ttl time.Duration) *LinkSigner {
+	return &LinkSigner{
+		key: key,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Sign returns the query parameters that authorise a download of id until the
+// signer's TTL elapses.
+func (l *LinkSigner) Sign(id string) url.Values {
+
+	expires := l.now().Add(l.ttl).Unix()
+	v := make(url.Values, 2)
+	v.Set(linkExpiresParam, strconv.FormatInt(expires, 10))
+	v.Set(linkSignatureParam, l.signature(id, expires))
+	return v
+}
+
+// Verify checks that v carries a valid, unexpired signature for id.
+func (l *LinkSigner) Verify(id string, v url.Values) error {
+
+	sig := v.Get(linkSignatureParam)
+	if sig == "" {
+		return ServerError{Code: http.StatusUnauthorized, Description: "link is not signed"}
+	}
+	expires, err := strconv.ParseInt(v.Get(linkExpiresParam), 10, 64)
+	if err != nil {
+		return ServerError{Code: http.StatusUnauthorized, Description: "link has an invalid expiry"}
+	}
+	if !hmac.Equal([]byte(sig), []byte(l.signature(id, expires))) {
+		return ServerError{Code: http.StatusUnauthorized, Description: "link signature is invalid"}
+	}
+	if l.now().Unix() > expires {
+		return ServerError{Code: http.StatusUnauthorized, Description: "link has expired"}
+	}
+	return nil
+}
+
+func (l *LinkSigner) signature(id string, expires int64) string {
+
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(id))
+	mac.Write([]byte{':'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,40 @@
+package newznab
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkSigner_VerifiesOwnSignature(t *testing.T) {
+
+	s := NewLinkSigner([]byte("secret"), time.Hour)
+	v := s.Sign("abc")
+	assert.Nil(t, s.Verify("abc", v))
+}
+
+func TestLinkSigner_RejectsOtherID(t *testing.T) {
+
+	s := NewLinkSigner([]byte("secret"), time.Hour)
+	v := s.Sign("abc")
+	var srvErr ServerError
+	assert.True(t, errors.As(s.Verify("abd", v), &srvErr))
+}
+
+func TestLinkSigner_RejectsOtherKey(t *testing.T) {
+
+	v := NewLinkSigner([]byte("secret"), time.Hour).Sign("abc")
+	assert.NotNil(t, NewLinkSigner([]byte("other"), time.Hour).Verify("abc", v))
+}
+
+func TestLinkSigner_RejectsExpired(t *testing.T) {
+
+	s := NewLinkSigner([]byte("secret"), time.Minute)
+	v := s.Sign("abc")
+	s.now = func() time.Time {
+		return time.Now().Add(time.Hour)
+	}
+	assert.NotNil(t, s.Verify("abc", v))
+}
@@ -0,0 +1,67 @@
+package newznab
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/henges/newznab-proxy/xmlutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/henges/newznab-proxy/newznab")
+
+// traced serves h in a span named name, continuing any trace propagated by
+// the caller. The API key is left out of the span, as is the rest of the
+// query string besides t.
+func traced(name string, h http.HandlerFunc) http.Handler {
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		))
+		defer span.End()
+		if t := r.URL.Query().Get("t"); t != "" {
+			span.SetAttributes(attribute.String("newznab.t", t))
+		}
+		h(rw, r.WithContext(ctx))
+	})
+}
+
+// startSpan starts a span for a call to the client's backend.
+func (c *Client) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("newznab.backend", c.name)))
+}
+
+// decodeFeed decodes an RSS feed from r in a span of its own, as large feeds
+// can take a while.
+func decodeFeed(ctx context.Context, r io.Reader) (*RssFeed, error) {
+
+	_, span := tracer.Start(ctx, "xml.decode")
+	defer span.End()
+	var ret RssFeed
+	err := xmlutil.NewDecoder(r).Decode(&ret)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("newznab.items", len(ret.Channel.Items)))
+	return &ret, nil
+}
+
+// recordError marks span as failed if err is not nil.
+func recordError(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
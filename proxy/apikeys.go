@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// legacyAPIKey is accepted until the first API key is created, as it was the
+// only key before keys were stored.
+const legacyAPIKey = "0"
+
+// NewAPIKey generates a new random key with the given name.
+func NewAPIKey(name string) APIKey {
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	return APIKey{
+		Key:       hex.EncodeToString(b),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+}
+
+// APIKeys returns the keys the newznab API accepts.
+func (p *Proxy) APIKeys(ctx context.Context) ([]string, error) {
+
+	keys, err := p.s.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return []string{legacyAPIKey}, nil
+	}
+	return p.s.ListActiveAPIKeys(ctx)
+}
@@ -4,14 +4,20 @@ import (
 	"cmp"
 	"os"
 	"time"
-
-	"github.com/goccy/go-yaml"
 )
 
 type Config struct {
 	Web      WebConfig       `yaml:"web"`
+	Admin    AdminConfig     `yaml:"admin"`
 	Storage  StorageConfig   `yaml:"storage"`
 	Backends []BackendConfig `yaml:"backends"`
+	Filters  []FilterConfig  `yaml:"filters"`
+	Ranking  RankingConfig   `yaml:"ranking"`
+	// VirtualFeeds are served from stored items at /feeds/{name}/.
+	VirtualFeeds []VirtualFeedConfig `yaml:"virtualFeeds"`
+	Tracing      TracingConfig       `yaml:"tracing"`
+	Log          LogConfig           `yaml:"log"`
+	Retention    RetentionConfig     `yaml:"retention"`
 }
 
 type WebConfig struct {
@@ -19,6 +25,65 @@ type WebConfig struct {
 	ListenAddr   string `yaml:"listenAddr"`
 	Port         uint16 `yaml:"port"`
 	TLS          bool   `yaml:"tls"`
+	// LinkSecret, if set, is used to sign rewritten NZB links so that they
+	// can be fetched without an API key until LinkTTL elapses.
+	LinkSecret string        `yaml:"linkSecret"`
+	LinkTTL    time.Duration `yaml:"linkTtl"`
+}
+
+// AdminConfig configures the admin API, which is disabled unless APIKey is
+// set.
+type AdminConfig struct {
+	APIKey string `yaml:"apiKey"`
+	// APIKeyFile, if set, is a file the API key is read from instead.
+	APIKeyFile string `yaml:"apiKeyFile,omitempty"`
+}
+
+// TracingConfig configures exporting traces over OTLP/HTTP, which is disabled
+// unless Endpoint is set.
+type TracingConfig struct {
+	// Endpoint is the collector's host and port, e.g. localhost:4318.
+	Endpoint string            `yaml:"endpoint"`
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	// ServiceName defaults to newznab-proxy.
+	ServiceName string `yaml:"serviceName"`
+	// SampleRatio is the fraction of traces sampled, defaulting to all of
+	// them.
+	SampleRatio *float64 `yaml:"sampleRatio"`
+}
+
+// LogConfig configures logging. Format is "text" (the default) or "json", and
+// Level is one of debug, info (the default), warn or error.
+type LogConfig struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+// RetentionConfig configures deleting stored items some time after they
+// were first stored. Nothing is deleted unless MaxAge or a rule's MaxAge is
+// set.
+type RetentionConfig struct {
+	// MaxAge is how long items are kept if no rule matches them. Zero keeps
+	// them forever.
+	MaxAge time.Duration `yaml:"maxAge"`
+	// Rules set how long the items of some backends or sources are kept. The
+	// first rule matching an item applies.
+	Rules []RetentionRule `yaml:"rules,omitempty"`
+	// KeepGrabbed keeps items that were grabbed successfully, however old
+	// they are.
+	KeepGrabbed bool `yaml:"keepGrabbed"`
+	// Interval is how often expired items are deleted. Defaults to a day.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// RetentionRule sets how long the items of Backends from Source, rss or
+// search, are kept. Empty Backends or Source match everything, and a zero
+// MaxAge keeps items forever.
+type RetentionRule struct {
+	Backends []string      `yaml:"backends,omitempty"`
+	Source   string        `yaml:"source,omitempty"`
+	MaxAge   time.Duration `yaml:"maxAge"`
 }
 
 type StorageConfig struct {
@@ -27,10 +92,20 @@ type StorageConfig struct {
 }
 
 type BackendConfig struct {
-	Name    string     `yaml:"name"`
-	BaseURL string     `yaml:"baseUrl"`
-	APIKey  string     `yaml:"apiKey"`
-	RSS     *RSSConfig `yaml:"rss,omitempty"`
+	Name    string `yaml:"name"`
+	BaseURL string `yaml:"baseUrl"`
+	APIKey  string `yaml:"apiKey"`
+	// APIKeyFile, if set, is a file the API key is read from instead, such
+	// as a mounted secret.
+	APIKeyFile string `yaml:"apiKeyFile,omitempty"`
+	// Priority ranks results from this backend above those from backends
+	// with a lower priority when scoring.
+	Priority int        `yaml:"priority"`
+	RSS      *RSSConfig `yaml:"rss,omitempty"`
+	// DailyAPILimit and DailyGrabLimit are the indexer's quotas, shown
+	// alongside usage. They aren't enforced.
+	DailyAPILimit  int `yaml:"dailyApiLimit,omitempty"`
+	DailyGrabLimit int `yaml:"dailyGrabLimit,omitempty"`
 }
 
 type RSSConfig struct {
@@ -43,22 +118,159 @@ type RSSFeed struct {
 	Name         string            `yaml:"name"`
 	PollInterval time.Duration     `yaml:"pollInterval"`
 	QueryParams  map[string]string `yaml:"queryParams"`
+	// Cron is a standard five-field cron expression that, if set, is used
+	// instead of PollInterval.
+	Cron string `yaml:"cron,omitempty"`
+	// Windows override PollInterval during certain times of day, e.g. to poll
+	// less overnight.
+	Windows []PollWindow `yaml:"windows,omitempty"`
+	// Timezone is the IANA zone Cron and Windows are evaluated in. Defaults
+	// to the local zone.
+	Timezone string `yaml:"timezone,omitempty"`
+	// MaxCatchUpPages bounds how many pages a poll reads looking for the last
+	// item it saw. Defaults to 10; set to 1 to only ever read one page.
+	MaxCatchUpPages int `yaml:"maxCatchUpPages,omitempty"`
+	// OffsetParam is the query parameter used to page. Defaults to offset.
+	OffsetParam string `yaml:"offsetParam,omitempty"`
+	// Jitter is the most that is randomly added to each interval, and the
+	// longest the first poll is delayed by. Defaults to a tenth of the interval.
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+	// MaxBackoff caps the interval while the feed is failing, which doubles
+	// with each consecutive failure. Defaults to an hour, or the interval if
+	// that is longer.
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+	// Adaptive, if set, lengthens the interval while polls find nothing new
+	// and shortens it while they find mostly new items. It only applies to
+	// plain PollInterval schedules.
+	Adaptive *AdaptiveIntervalConfig `yaml:"adaptive,omitempty"`
+}
+
+// PollWindow is a daily period, given as HH:MM, during which a feed is
+// polled every Interval. A window whose To is before its From runs past
+// midnight. Days restricts the window to the days it starts on, e.g. [sat, sun].
+type PollWindow struct {
+	From     string        `yaml:"from"`
+	To       string        `yaml:"to"`
+	Interval time.Duration `yaml:"interval"`
+	Days     []string      `yaml:"days,omitempty"`
+}
+
+type AdaptiveIntervalConfig struct {
+	MinInterval time.Duration `yaml:"minInterval"`
+	MaxInterval time.Duration `yaml:"maxInterval"`
+}
+
+// FilterConfig is a rule that rejects feed items. A rule applies to every
+// backend and API key unless Backends or APIKeys is set, in which case it only
+// applies to those.
+type FilterConfig struct {
+	Name     string   `yaml:"name"`
+	Backends []string `yaml:"backends,omitempty"`
+	APIKeys  []string `yaml:"apiKeys,omitempty"`
+
+	// AllowTitles are regular expressions, at least one of which titles must
+	// match if any are set.
+	AllowTitles []string `yaml:"allowTitles,omitempty"`
+	// DenyTitles are regular expressions, none of which titles may match.
+	DenyTitles    []string          `yaml:"denyTitles,omitempty"`
+	BlockedGroups []string          `yaml:"blockedGroups,omitempty"`
+	Sizes         []SizeBoundConfig `yaml:"sizes,omitempty"`
+	// DenyAttrs rejects items having any of these attr values, e.g. password: "1".
+	DenyAttrs map[string]string `yaml:"denyAttrs,omitempty"`
+}
+
+// SizeBoundConfig bounds the size of items in Categories. A category ending in
+// 000 also covers its subcategories. Sizes are human-readable, e.g. 200MB.
+type SizeBoundConfig struct {
+	Categories []string `yaml:"categories,omitempty"`
+	Min        string   `yaml:"min,omitempty"`
+	Max        string   `yaml:"max,omitempty"`
+}
+
+// VirtualFeedConfig defines a named view over stored items that can be added
+// to clients as an indexer in its own right. Empty Backends or Categories
+// include everything.
+type VirtualFeedConfig struct {
+	Name       string         `yaml:"name"`
+	Backends   []string       `yaml:"backends,omitempty"`
+	Categories []string       `yaml:"categories,omitempty"`
+	Filters    []FilterConfig `yaml:"filters,omitempty"`
+	// APIKeys may access the feed. If empty, the server's keys are used.
+	APIKeys []string `yaml:"apiKeys,omitempty"`
+}
+
+// RankingConfig defines the scoring profiles used to order search results
+// when the client doesn't request a sort. Results are left in their original
+// order if no profiles are configured.
+type RankingConfig struct {
+	DefaultProfile string `yaml:"defaultProfile"`
+	// APIKeyProfiles maps API keys to the profile used for their searches.
+	APIKeyProfiles map[string]string `yaml:"apiKeyProfiles,omitempty"`
+	Profiles       []RankingProfile  `yaml:"profiles"`
+}
+
+// RankingProfile scores each item as the weighted sum of its components, each
+// of which is normalised to between 0 and 1. Negative weights penalise a
+// component, e.g. a negative Size weight prefers smaller releases.
+type RankingProfile struct {
+	Name    string         `yaml:"name"`
+	Weights RankingWeights `yaml:"weights"`
+	// Resolutions and Sources score parsed quality; unlisted values score 0.
+	Resolutions map[string]float64 `yaml:"resolutions,omitempty"`
+	Sources     map[string]float64 `yaml:"sources,omitempty"`
+	// AgeHalfLife is the age at which an item's age score halves.
+	AgeHalfLife time.Duration `yaml:"ageHalfLife,omitempty"`
+}
+
+type RankingWeights struct {
+	Quality    float64 `yaml:"quality"`
+	Size       float64 `yaml:"size"`
+	Age        float64 `yaml:"age"`
+	Priority   float64 `yaml:"priority"`
+	Popularity float64 `yaml:"popularity"`
+	Relevance  float64 `yaml:"relevance"`
 }
 
 const configPathEnvVar = "NEWZNAB_PROXY_CONFIG_PATH"
 
 func MustGetConfig() *Config {
 
-	confPath := cmp.Or(os.Getenv(configPathEnvVar), ".my.config.yaml")
-	f, err := os.Open(confPath)
+	c, err := LoadConfig(ConfigPath())
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
-	var c Config
-	err = yaml.NewDecoder(f).Decode(&c)
+	return c
+}
+
+// ConfigPath returns the path the config is read from.
+func ConfigPath() string {
+	return cmp.Or(os.Getenv(configPathEnvVar), ".my.config.yaml")
+}
+
+// LoadConfig reads and validates the config at path. ${VAR} references in the
+// file's values are replaced with the values of environment variables, after
+// which any NEWZNAB_PROXY_* overrides are applied and API key files are read.
+func LoadConfig(path string) (*Config, error) {
+
+	b, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	c, err := decodeConfig(b, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	err = applyEnvOverrides(c, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	err = c.readSecretFiles()
+	if err != nil {
+		return nil, err
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, err
 	}
-	return &c
+	return c, nil
 }
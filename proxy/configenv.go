@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+const envOverridePrefix = "NEWZNAB_PROXY_"
+
+var envRefPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// decodeConfig decodes the YAML in b, expanding environment variable
+// references in its values with expandEnv.
+func decodeConfig(b []byte, lookup func(string) (string, bool)) (*Config, error) {
+
+	var c Config
+	f, err := parser.ParseBytes(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Docs) == 0 || f.Docs[0].Body == nil {
+		return &c, nil
+	}
+	body, err := expandEnv(f.Docs[0].Body, lookup)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.NodeToValue(body, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// expandEnv expands references in the scalar values under n with
+// expandString. Keys and comments are left alone, and a value can't change
+// the structure of the document. An unquoted value that expands to a
+// number, bool or null is treated as one, as it would be if written out.
+func expandEnv(n ast.Node, lookup func(string) (string, bool)) (ast.Node, error) {
+
+	var errs []error
+	var expand func(n ast.Node) ast.Node
+	expand = func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.MappingNode:
+			for _, mv := range n.Values {
+				mv.Value = expand(mv.Value)
+			}
+		case *ast.MappingValueNode:
+			n.Value = expand(n.Value)
+		case *ast.SequenceNode:
+			for i, v := range n.Values {
+				n.Values[i] = expand(v)
+			}
+		case *ast.AnchorNode:
+			n.Value = expand(n.Value)
+		case *ast.TagNode:
+			n.Value = expand(n.Value)
+		case *ast.LiteralNode:
+			v, err := expandString(n.Value.Value, lookup)
+			errs = append(errs, err)
+			n.Value.Value = v
+		case *ast.StringNode:
+			v, err := expandString(n.Value, lookup)
+			errs = append(errs, err)
+			if v == n.Value {
+				break
+			}
+			if n.Token.Type == token.StringType {
+				return plainScalar(v, n)
+			}
+			n.Value = v
+		}
+		return n
+	}
+	n = expand(n)
+	return n, errors.Join(errs...)
+}
+
+// plainScalar returns the node for v as an unquoted value in place of n.
+func plainScalar(v string, n *ast.StringNode) ast.Node {
+
+	if v == "" {
+		return ast.Null(token.New("null", "null", n.Token.Position))
+	}
+	f, err := parser.ParseBytes([]byte(v), 0)
+	if err == nil && len(f.Docs) == 1 && f.Docs[0].Body != nil {
+		switch body := f.Docs[0].Body.(type) {
+		case *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.NullNode, *ast.InfinityNode, *ast.NanNode:
+			// Anything after the value, such as a comment, makes it a string.
+			if body.GetToken().Value == v {
+				return body
+			}
+		}
+	}
+	n.Value = v
+	return n
+}
+
+// expandString replaces ${VAR} in s with the value of VAR, or with default
+// for ${VAR:-default} if VAR is unset or empty. $$ escapes a literal $. It is
+// an error to reference an unset variable without a default.
+func expandString(s string, lookup func(string) (string, bool)) (string, error) {
+
+	var errs []error
+	ret := envRefPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		groups := envRefPattern.FindStringSubmatch(match)
+		name := groups[1]
+		v, ok := lookup(name)
+		switch {
+		case v != "":
+			return v
+		case groups[2] != "":
+			return groups[3]
+		case ok:
+			return ""
+		}
+		errs = append(errs, fmt.Errorf("environment variable %s is not set", name))
+		return match
+	})
+	return ret, errors.Join(errs...)
+}
+
+// applyEnvOverrides sets fields of c from NEWZNAB_PROXY_* variables in
+// environ, named after the path of the field with each key in upper snake
+// case, e.g. NEWZNAB_PROXY_WEB_PORT or NEWZNAB_PROXY_BACKENDS_0_API_KEY.
+// Values are parsed as YAML, so lists and durations can be given as they
+// would be in the file. An entry of a map is named by its key, e.g.
+// NEWZNAB_PROXY_TRACING_HEADERS_Authorization.
+func applyEnvOverrides(c *Config, environ []string) error {
+
+	var errs []error
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envOverridePrefix) || name == configPathEnvVar {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(name, envOverridePrefix), "_")
+		err := setPath(reflect.ValueOf(c).Elem(), path, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setPath(v reflect.Value, path []string, value string) error {
+
+	if len(path) == 0 {
+		return setValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), path, value)
+	case reflect.Struct:
+		// Prefer the longest match, in case one field name prefixes another.
+		best, bestLen := -1, 0
+		for i := range v.NumField() {
+			tokens := strings.Split(envName(v.Type().Field(i)), "_")
+			if len(tokens) > bestLen && len(tokens) <= len(path) && slices.Equal(tokens, path[:len(tokens)]) {
+				best, bestLen = i, len(tokens)
+			}
+		}
+		if best < 0 {
+			return errors.New("no such config field")
+		}
+		return setPath(v.Field(best), path[bestLen:], value)
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= v.Len() {
+			return fmt.Errorf("no item %s in list of %d", path[0], v.Len())
+		}
+		return setPath(v.Index(i), path[1:], value)
+	case reflect.Map:
+		// The rest of the path is the key, as written. An existing key that
+		// differs only in case is replaced.
+		key := strings.Join(path, "_")
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, k := range v.MapKeys() {
+			if strings.EqualFold(k.String(), key) {
+				v.SetMapIndex(k, reflect.Value{})
+			}
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		err := setValue(elem, value)
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		return nil
+	default:
+		return errors.New("no such config field")
+	}
+}
+
+func setValue(v reflect.Value, value string) error {
+
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	ptr := reflect.New(v.Type())
+	err := yaml.Unmarshal([]byte(value), ptr.Interface())
+	if err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// envName converts the YAML key of f to upper snake case.
+func envName(f reflect.StructField) string {
+
+	key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if key == "" {
+		key = f.Name
+	}
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// readSecretFiles replaces API keys with the contents of their files where
+// a file is given.
+func (c *Config) readSecretFiles() error {
+
+	var errs []error
+	read := func(path, file string, into *string) {
+		if file == "" {
+			return
+		}
+		if *into != "" {
+			errs = append(errs, fmt.Errorf("%s: apiKey and apiKeyFile cannot both be set", path))
+			return
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.apiKeyFile: %w", path, err))
+			return
+		}
+		*into = strings.TrimSpace(string(b))
+	}
+	read("admin", c.Admin.APIKeyFile, &c.Admin.APIKey)
+	for i := range c.Backends {
+		read(fmt.Sprintf("backends[%d]", i), c.Backends[i].APIKeyFile, &c.Backends[i].APIKey)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeConfig_expandsEnv(t *testing.T) {
+
+	env := map[string]string{"KEY": "se: cr#et\nkey", "EMPTY": "", "PRIORITY": "-2"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	c, err := decodeConfig([]byte(`# ${MISSING} in a comment is ignored
+web:
+  port: ${PORT:-8080}
+admin:
+  apiKey: "${EMPTY}"
+backends:
+  - name: a # ${MISSING}
+    apiKey: ${KEY}
+    priority: ${PRIORITY}
+filters:
+  - name: f
+    denyTitles: ["x264$", "$${KEY}"]
+`), lookup)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(8080), c.Web.Port)
+	assert.Empty(t, c.Admin.APIKey)
+	require.Len(t, c.Backends, 1)
+	assert.Equal(t, "se: cr#et\nkey", c.Backends[0].APIKey)
+	assert.Equal(t, -2, c.Backends[0].Priority)
+	require.Len(t, c.Filters, 1)
+	assert.Equal(t, []string{"x264$", "${KEY}"}, c.Filters[0].DenyTitles)
+
+	_, err = decodeConfig([]byte("admin:\n  apiKey: ${MISSING}"), lookup)
+	assert.ErrorContains(t, err, "MISSING")
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+
+	c := &Config{Backends: []BackendConfig{{Name: "a"}}}
+	err := applyEnvOverrides(c, []string{
+		"NEWZNAB_PROXY_WEB_PORT=9090",
+		"NEWZNAB_PROXY_WEB_LINK_TTL=1h",
+		"NEWZNAB_PROXY_BACKENDS_0_API_KEY=k",
+		"NEWZNAB_PROXY_BACKENDS_0_RSS_RSS_PATH=api",
+		"NEWZNAB_PROXY_BACKENDS_0_RSS_RSS_QUERY_PARAMS_dl=1",
+		"NEWZNAB_PROXY_TRACING_HEADERS_Authorization=Bearer x",
+		"NEWZNAB_PROXY_CONFIG_PATH=ignored",
+		"HOME=/root",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(9090), c.Web.Port)
+	assert.Equal(t, time.Hour, c.Web.LinkTTL)
+	assert.Equal(t, "k", c.Backends[0].APIKey)
+	assert.Equal(t, "api", c.Backends[0].RSS.RSSPath)
+	assert.Equal(t, map[string]string{"dl": "1"}, c.Backends[0].RSS.RSSQueryParams)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer x"}, c.Tracing.Headers)
+
+	assert.Error(t, applyEnvOverrides(c, []string{"NEWZNAB_PROXY_WEB_PROT=1"}))
+	assert.Error(t, applyEnvOverrides(c, []string{"NEWZNAB_PROXY_BACKENDS_1_NAME=b"}))
+}
+
+func TestConfig_ReadSecretFiles(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(file, []byte("secret\n"), 0600))
+	c := &Config{Backends: []BackendConfig{{Name: "a", APIKeyFile: file}}}
+	require.NoError(t, c.readSecretFiles())
+	assert.Equal(t, "secret", c.Backends[0].APIKey)
+
+	c = &Config{Admin: AdminConfig{APIKey: "a", APIKeyFile: file}}
+	assert.Error(t, c.readSecretFiles())
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/henges/newznab-proxy/release"
+)
+
+type filterRule struct {
+	name          string
+	backends      []string
+	apiKeys       []string
+	allowTitles   []*regexp.Regexp
+	denyTitles    []*regexp.Regexp
+	blockedGroups []string
+	sizes         []sizeBound
+	denyAttrs     map[string]string
+}
+
+type sizeBound struct {
+	categories []string
+	min, max   int64
+}
+
+type filters []filterRule
+
+func newFilters(cfgs []FilterConfig) (filters, error) {
+
+	ret := make(filters, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		rule, err := newFilterRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", cfg.Name, err)
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+func newFilterRule(cfg FilterConfig) (filterRule, error) {
+
+	ret := filterRule{
+		name:      cfg.Name,
+		backends:  cfg.Backends,
+		apiKeys:   cfg.APIKeys,
+		denyAttrs: cfg.DenyAttrs,
+	}
+	var err error
+	ret.allowTitles, err = compileTitlePatterns(cfg.AllowTitles)
+	if err != nil {
+		return ret, err
+	}
+	ret.denyTitles, err = compileTitlePatterns(cfg.DenyTitles)
+	if err != nil {
+		return ret, err
+	}
+	for _, g := range cfg.BlockedGroups {
+		ret.blockedGroups = append(ret.blockedGroups, strings.ToLower(g))
+	}
+	for _, s := range cfg.Sizes {
+		bound := sizeBound{categories: s.Categories}
+		if s.Min != "" {
+			v, err := humanize.ParseBytes(s.Min)
+			if err != nil {
+				return ret, fmt.Errorf("min size: %w", err)
+			}
+			bound.min = int64(v)
+		}
+		if s.Max != "" {
+			v, err := humanize.ParseBytes(s.Max)
+			if err != nil {
+				return ret, fmt.Errorf("max size: %w", err)
+			}
+			bound.max = int64(v)
+		}
+		ret.sizes = append(ret.sizes, bound)
+	}
+	return ret, nil
+}
+
+// compileTitlePatterns compiles patterns as case-insensitive regexps.
+func compileTitlePatterns(patterns []string) ([]*regexp.Regexp, error) {
+
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+// appliesTo reports whether the rule is in scope for items from indexer
+// requested with apiKey. Rules scoped to API keys never apply when apiKey is
+// empty, as is the case during RSS ingest.
+func (r filterRule) appliesTo(indexer, apiKey string) bool {
+
+	if len(r.backends) > 0 && !slices.Contains(r.backends, indexer) {
+		return false
+	}
+	if len(r.apiKeys) > 0 && !slices.Contains(r.apiKeys, apiKey) {
+		return false
+	}
+	return true
+}
+
+// rejects returns the reason the rule rejects fi, or "" if it doesn't.
+func (r filterRule) rejects(fi FeedItem) string {
+
+	if len(r.allowTitles) > 0 && !slices.ContainsFunc(r.allowTitles, func(re *regexp.Regexp) bool {
+		return re.MatchString(fi.Title)
+	}) {
+		return "title matches no allowed pattern"
+	}
+	for _, re := range r.denyTitles {
+		if re.MatchString(fi.Title) {
+			return fmt.Sprintf("title matches denied pattern %s", re)
+		}
+	}
+	if group := strings.ToLower(fi.Attrs[release.AttrGroup]); group != "" && slices.Contains(r.blockedGroups, group) {
+		return fmt.Sprintf("release group %s is blocked", fi.Attrs[release.AttrGroup])
+	}
+	for _, b := range r.sizes {
+		if !b.appliesTo(fi.categories()) {
+			continue
+		}
+		if b.min > 0 && fi.Size < b.min {
+			return fmt.Sprintf("size %s is below minimum %s", humanize.Bytes(uint64(fi.Size)), humanize.Bytes(uint64(b.min)))
+		}
+		if b.max > 0 && fi.Size > b.max {
+			return fmt.Sprintf("size %s is above maximum %s", humanize.Bytes(uint64(fi.Size)), humanize.Bytes(uint64(b.max)))
+		}
+	}
+	for k, v := range r.denyAttrs {
+		if have, ok := fi.Attrs[k]; ok && have == v {
+			return fmt.Sprintf("attr %s=%s", k, v)
+		}
+	}
+	return ""
+}
+
+func (b sizeBound) appliesTo(categories []string) bool {
+
+	if len(b.categories) == 0 {
+		return true
+	}
+	return anyCategoryMatches(b.categories, categories)
+}
+
+// categoryMatches reports whether have is want, or a subcategory of want when
+// want is a top-level category such as 5000.
+func categoryMatches(want, have string) bool {
+
+	if want == have {
+		return true
+	}
+	parent, ok := parentCategory(want)
+	if !ok {
+		return false
+	}
+	id, err := strconv.ParseInt(have, 10, 64)
+	return err == nil && id/1000*1000 == parent
+}
+
+// parentCategory returns c as a number if it is a top-level category, one
+// that is a multiple of 1000 such as 5000 or 100000.
+func parentCategory(c string) (int64, bool) {
+
+	id, err := strconv.ParseInt(c, 10, 64)
+	if err != nil || id <= 0 || id%1000 != 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// anyCategoryMatches reports whether any of have matches any of want.
+func anyCategoryMatches(want, have []string) bool {
+
+	return slices.ContainsFunc(want, func(w string) bool {
+		return slices.ContainsFunc(have, func(h string) bool {
+			return categoryMatches(w, h)
+		})
+	})
+}
+
+// apply returns the items that no applicable rule rejects, logging those that
+// are dropped.
+func (f filters) apply(items []FeedItem, apiKey string) []FeedItem {
+
+	if len(f) == 0 {
+		return items
+	}
+	return slices.DeleteFunc(items, func(fi FeedItem) bool {
+		return !f.allows(fi, apiKey)
+	})
+}
+
+// allows reports whether no applicable rule rejects fi, logging the rule that
+// does if one does.
+func (f filters) allows(fi FeedItem, apiKey string) bool {
+
+	for _, r := range f {
+		if !r.appliesTo(fi.IndexerName, apiKey) {
+			continue
+		}
+		if reason := r.rejects(fi); reason != "" {
+			slog.Info("filter rejected item", "backend", fi.IndexerName, "rule", r.name, "title", fi.Title, "reason", reason)
+			return false
+		}
+	}
+	return true
+}
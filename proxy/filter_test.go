@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilters_Apply(t *testing.T) {
+
+	f, err := newFilters([]FilterConfig{
+		{
+			Name:       "global",
+			DenyTitles: []string{`\.exe$`},
+			DenyAttrs:  map[string]string{"password": "1"},
+			Sizes:      []SizeBoundConfig{{Categories: []string{"5000"}, Min: "100MB"}},
+		},
+		{
+			Name:          "backend",
+			Backends:      []string{"a"},
+			BlockedGroups: []string{"bad"},
+		},
+		{
+			Name:        "key",
+			APIKeys:     []string{"k"},
+			AllowTitles: []string{`german`},
+		},
+	})
+	require.Nil(t, err)
+
+	items := []FeedItem{
+		{IndexerName: "a", Title: "ok", Size: 1 << 30, Attrs: map[string]string{"category": "5040"}},
+		{IndexerName: "a", Title: "virus.exe"},
+		{IndexerName: "b", Title: "locked", Attrs: map[string]string{"password": "1"}},
+		{IndexerName: "a", Title: "small", Size: 1 << 20, Attrs: map[string]string{"category": "5040"}},
+		{IndexerName: "b", Title: "small movie", Size: 1 << 20, Attrs: map[string]string{"category": "2040"}},
+		{IndexerName: "b", Title: "small tv", Size: 1 << 20, Attrs: map[string]string{"category": "100040"}, Categories: []string{"5040", "100040"}},
+		{IndexerName: "a", Title: "grp", Attrs: map[string]string{"team": "BAD"}},
+		{IndexerName: "b", Title: "grp", Attrs: map[string]string{"team": "BAD"}},
+	}
+	titles := func(fis []FeedItem) []string {
+		var ret []string
+		for _, fi := range fis {
+			ret = append(ret, fi.IndexerName+":"+fi.Title)
+		}
+		return ret
+	}
+
+	assert.Equal(t, []string{"a:ok", "b:small movie", "b:grp"}, titles(f.apply(append([]FeedItem(nil), items...), "")))
+	assert.Empty(t, f.apply(append([]FeedItem(nil), items...), "k"))
+}
+
+func TestNewFilters_InvalidConfig(t *testing.T) {
+
+	_, err := newFilters([]FilterConfig{{Name: "x", DenyTitles: []string{"("}}})
+	assert.NotNil(t, err)
+	_, err = newFilters([]FilterConfig{{Name: "x", Sizes: []SizeBoundConfig{{Min: "lots"}}}})
+	assert.NotNil(t, err)
+}
+
+func TestProxy_searchFiltersBeforeStoring(t *testing.T) {
+
+	ctx := context.Background()
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		items := []newznab.Item{
+			{Title: "Some.Show.S01E01", GUID: newznab.RssGuid{Value: "1"}},
+			{Title: "Some.Show.S01E02.exe", GUID: newznab.RssGuid{Value: "2"}},
+			{Title: "Some.Show.S01E03.German", GUID: newznab.RssGuid{Value: "3"}},
+		}
+		body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, len(items), items))
+		rw.Write(body)
+	}))
+	defer backend.Close()
+
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Backends[0].BaseURL = backend.URL
+	c.Backends[0].RSS = nil
+	c.Filters = []FilterConfig{
+		{Name: "global", DenyTitles: []string{`\.exe$`}},
+		{Name: "key", APIKeys: []string{"k"}, DenyTitles: []string{`german`}},
+	}
+	p, err := NewProxy(ctx, c)
+	require.NoError(t, err)
+	res, err := p.Search(newznab.ContextWithAPIKey(ctx, "k"), newznab.SearchParams{Query: "some show"})
+	require.NoError(t, err)
+	require.Len(t, res.Channel.Items, 1)
+
+	// Items rejected for one key are kept for others.
+	stored, err := p.s.SearchForFeedItem(ctx, "some show")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Some.Show.S01E01", "Some.Show.S01E03.German"}, lo.Map(stored, func(fi FeedItem, _ int) string {
+		return fi.Title
+	}))
+}
+
+func TestProxy_searchSkipsStoredItems(t *testing.T) {
+
+	ctx := context.Background()
+	items := []newznab.Item{
+		{Title: "Some.Show.S01E01", GUID: newznab.RssGuid{Value: "1"}},
+		{Title: "Some.Show.S01E03.German", GUID: newznab.RssGuid{Value: "3"}},
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, len(items), items))
+		rw.Write(body)
+	}))
+	defer backend.Close()
+
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Backends[0].BaseURL = backend.URL
+	c.Backends[0].RSS = nil
+	c.Filters = []FilterConfig{{Name: "key", APIKeys: []string{"k"}, DenyTitles: []string{`german`}}}
+	p, err := NewProxy(ctx, c)
+	require.NoError(t, err)
+	// The stored item is hidden from "k", so its search goes to the backend,
+	// which returns the item again.
+	require.NoError(t, p.s.InsertFeedItem(ctx, FeedItemFromNewznab(items[1], c.Backends[0].Name, FeedItemSourceSearch)))
+	res, err := p.Search(newznab.ContextWithAPIKey(ctx, "k"), newznab.SearchParams{Query: "some show"})
+	require.NoError(t, err)
+	require.Len(t, res.Channel.Items, 1)
+	assert.Equal(t, "Some.Show.S01E01", res.Channel.Items[0].Title)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrabHistory(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProxy(ctx, reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite")))
+	require.NoError(t, err)
+	key := NewAPIKey("sonarr")
+	require.NoError(t, p.s.InsertAPIKey(ctx, key))
+	now := time.Now()
+	for _, g := range []Grab{
+		{FeedItemID: "1", IndexerName: "a", Title: "Some.Show.S01E01", APIKey: key.Key, GrabbedAt: now.Add(-48 * time.Hour), Size: 100},
+		{FeedItemID: "2", IndexerName: "b", Title: "some.show.s01e01", GrabbedAt: now.Add(-time.Hour), Error: "timeout"},
+		{FeedItemID: "3", IndexerName: "a", Title: "Other.Show.S02E03", APIKey: key.Key, GrabbedAt: now, Size: 50},
+	} {
+		require.NoError(t, p.s.InsertGrab(ctx, g))
+	}
+	ids := func(grabs []Grab) []string {
+		return lo.Map(grabs, func(g Grab, _ int) string { return g.FeedItemID })
+	}
+
+	grabs, err := p.Grabs(ctx, GrabQuery{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, ids(grabs))
+	assert.Equal(t, "sonarr", grabs[0].APIKeyName)
+	body, err := json.Marshal(grabs)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), key.Key)
+
+	grabs, err = p.Grabs(ctx, GrabQuery{APIKey: "sonarr", Title: "Some", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids(grabs))
+	grabs, err = p.Grabs(ctx, GrabQuery{Succeeded: lo.ToPtr(false), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(grabs))
+	grabs, err = p.Grabs(ctx, GrabQuery{Since: now.Add(-24 * time.Hour), IndexerName: "a", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, ids(grabs))
+
+	stats, err := p.GrabStats(ctx, now.Add(-72*time.Hour), "")
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	assert.Equal(t, GrabStats{IndexerName: "a", Grabs: 2, Bytes: 150, LastGrabbed: time.Unix(now.Unix(), 0)}, stats[0])
+	assert.Equal(t, 1, stats[1].Failed)
+
+	// A release is found by the title of any of its grabs, from any indexer.
+	res, err := p.ReleaseGrabs(ctx, "", "SOME.SHOW.S01E01")
+	require.NoError(t, err)
+	assert.True(t, res.Grabbed)
+	assert.Equal(t, []string{"2", "1"}, ids(res.Grabs))
+	res, err = p.ReleaseGrabs(ctx, "4", "")
+	require.NoError(t, err)
+	assert.False(t, res.Grabbed)
+	assert.Empty(t, res.Grabs)
+}
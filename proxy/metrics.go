@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbSizeDesc = prometheus.NewDesc("newznab_proxy_db_size_bytes",
+		"Size of the database.", nil, nil)
+	dbRowsDesc = prometheus.NewDesc("newznab_proxy_db_rows",
+		"Rows in each database table.", []string{"table"}, nil)
+	dbItemsDesc = prometheus.NewDesc("newznab_proxy_db_feed_items",
+		"Stored feed items, by backend and source.", []string{"backend", "source"}, nil)
+)
+
+const dbCollectTimeout = 5 * time.Second
+
+// dbCollector reports database statistics, read from the store on each
+// scrape.
+type dbCollector struct {
+	s *Store
+}
+
+// DBCollector returns a collector for the size and row counts of the
+// database.
+func (p *Proxy) DBCollector() prometheus.Collector {
+	return dbCollector{s: p.s}
+}
+
+func (c dbCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- dbSizeDesc
+	ch <- dbRowsDesc
+	ch <- dbItemsDesc
+}
+
+func (c dbCollector) Collect(ch chan<- prometheus.Metric) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbCollectTimeout)
+	defer cancel()
+	size, err := c.s.Size(ctx)
+	if err != nil {
+		slog.Error("error collecting database size", "err", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(dbSizeDesc, prometheus.GaugeValue, float64(size))
+	}
+	stats, err := c.s.GetDBStats(ctx)
+	if err != nil {
+		slog.Error("error collecting database stats", "err", err)
+		return
+	}
+	for table, n := range map[string]int{
+		"feed_items":     stats.FeedItems,
+		"feed_item_meta": stats.FeedItemMeta,
+		"search_cache":   stats.SearchCacheEntries,
+		"feed_poll_runs": stats.FeedPollRuns,
+		"api_keys":       stats.APIKeys,
+	} {
+		ch <- prometheus.MustNewConstMetric(dbRowsDesc, prometheus.GaugeValue, float64(n), table)
+	}
+	for _, ic := range stats.ItemsByIndexer {
+		ch <- prometheus.MustNewConstMetric(dbItemsDesc, prometheus.GaugeValue, float64(ic.Items), ic.IndexerName, string(ic.Source))
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBCollector(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProxy(ctx, reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite")))
+	require.NoError(t, err)
+	require.NoError(t, p.s.InsertFeedItem(ctx, FeedItem{
+		UUID:        "1",
+		IndexerName: "a",
+		Title:       "Some.Release",
+		PubDate:     time.Now(),
+		Source:      FeedItemSourceRSS,
+	}))
+
+	err = testutil.CollectAndCompare(p.DBCollector(), strings.NewReader(`
+# HELP newznab_proxy_db_feed_items Stored feed items, by backend and source.
+# TYPE newznab_proxy_db_feed_items gauge
+newznab_proxy_db_feed_items{backend="a",source="rss"} 1
+# HELP newznab_proxy_db_rows Rows in each database table.
+# TYPE newznab_proxy_db_rows gauge
+newznab_proxy_db_rows{table="api_keys"} 0
+newznab_proxy_db_rows{table="feed_item_meta"} 0
+newznab_proxy_db_rows{table="feed_items"} 1
+newznab_proxy_db_rows{table="feed_poll_runs"} 0
+newznab_proxy_db_rows{table="search_cache"} 0
+`), "newznab_proxy_db_feed_items", "newznab_proxy_db_rows")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(p.DBCollector(), "newznab_proxy_db_size_bytes"))
+}
@@ -60,6 +60,52 @@ func migrateDB(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
+// MigrationStatus is whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied bool
+	// Modified is set if the migration applied differs from this one.
+	Modified bool
+}
+
+// MigrationStatuses reports which migrations have been applied to the
+// database at path, without applying any.
+func MigrationStatuses(ctx context.Context, path string) ([]MigrationStatus, error) {
+
+	migs, err := loadMigrations(embeddedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%v", path))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var tables int
+	err = db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations';").Scan(&tables)
+	if err != nil {
+		return nil, err
+	}
+	var oldMigs migrations
+	if tables > 0 {
+		oldMigs, err = loadMigrationHistory(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret := make([]MigrationStatus, 0, len(migs))
+	for idx, mig := range migs {
+		status := MigrationStatus{Version: mig.version, Name: mig.name}
+		if idx < len(oldMigs) {
+			status.Applied = true
+			status.Modified = oldMigs[idx].version != mig.version || !bytes.Equal(oldMigs[idx].hash, mig.hash)
+		}
+		ret = append(ret, status)
+	}
+	return ret, nil
+}
+
 func loadMigrationHistory(ctx context.Context, db *sql.DB) (migrations, error) {
 
 	rows, err := db.QueryContext(ctx, "SELECT version, hash FROM schema_migrations ORDER BY version;")
@@ -101,6 +147,7 @@ func (m migrations) valid() error {
 
 type migration struct {
 	version int
+	name    string
 	content string
 	hash    []byte
 }
@@ -134,6 +181,7 @@ func loadMigrations(dir embed.FS) (migrations, error) {
 		hashArr := sha256.Sum256(content)
 		migs = append(migs, migration{
 			version: int(version),
+			name:    submatch[2],
 			content: string(content),
 			hash:    hashArr[:],
 		})
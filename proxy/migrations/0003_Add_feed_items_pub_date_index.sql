@@ -0,0 +1,2 @@
+-- Serve the newest items first for RSS and empty-query searches
+CREATE INDEX feed_items_pub_date ON feed_items (unixepoch(pub_date));
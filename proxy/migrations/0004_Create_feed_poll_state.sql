@@ -0,0 +1,12 @@
+-- Remember where each RSS feed was last read up to, so that polls can page
+-- back through anything missed since
+CREATE TABLE feed_poll_state
+(
+    indexer_name       TEXT    NOT NULL,
+    feed_name          TEXT    NOT NULL,
+    last_guid          TEXT    NOT NULL,
+    last_pub_date      TEXT    NOT NULL,
+    offset_unsupported INTEGER NOT NULL DEFAULT 0,
+    updated_at         INTEGER NOT NULL, -- Unix timestamp
+    PRIMARY KEY (indexer_name, feed_name)
+);
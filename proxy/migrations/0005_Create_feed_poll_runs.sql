@@ -0,0 +1,15 @@
+-- History of every RSS poll, for spotting feeds that have stopped working
+CREATE TABLE feed_poll_runs
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    indexer_name TEXT    NOT NULL,
+    feed_name    TEXT    NOT NULL,
+    started_at   INTEGER NOT NULL, -- Unix timestamp
+    finished_at  INTEGER NOT NULL, -- Unix timestamp
+    items_seen   INTEGER NOT NULL,
+    items_new    INTEGER NOT NULL,
+    http_status  INTEGER,          -- null if no response was received
+    error        TEXT              -- null if the poll succeeded
+);
+
+CREATE INDEX feed_poll_runs_feed ON feed_poll_runs (indexer_name, feed_name, id);
@@ -0,0 +1,8 @@
+-- API keys accepted by the newznab API, managed with the keys command
+CREATE TABLE api_keys
+(
+    key        TEXT PRIMARY KEY,
+    name       TEXT    NOT NULL UNIQUE,
+    created_at INTEGER NOT NULL, -- Unix timestamp
+    revoked_at INTEGER           -- Unix timestamp, null while the key is active
+);
@@ -0,0 +1,16 @@
+-- Every NZB fetched through the proxy. Items are referenced by uuid, and their
+-- title and indexer copied, so that history outlives the items themselves.
+CREATE TABLE grabs
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    feed_item_uuid TEXT    NOT NULL,
+    indexer_name   TEXT    NOT NULL,
+    title          TEXT    NOT NULL,
+    api_key        TEXT,             -- null if no key was given, e.g. for signed links
+    grabbed_at     INTEGER NOT NULL, -- Unix timestamp
+    size           INTEGER NOT NULL, -- bytes returned, 0 on error
+    error          TEXT              -- null if the grab succeeded
+);
+
+CREATE INDEX grabs_feed_item_uuid ON grabs (feed_item_uuid);
+CREATE INDEX grabs_indexer_name ON grabs (indexer_name, id);
@@ -0,0 +1,29 @@
+-- Every search received by the proxy, for seeing what clients search for and
+-- which searches find nothing. RSS sync searches have an empty query.
+CREATE TABLE search_log
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    searched_at    INTEGER NOT NULL, -- Unix timestamp
+    feed           TEXT,             -- the virtual feed searched, null for the proxy itself
+    query          TEXT    NOT NULL,
+    params         TEXT    NOT NULL, -- the other search params, URL-encoded
+    api_key        TEXT,
+    local_results  INTEGER NOT NULL, -- stored items matching the query
+    remote_results INTEGER NOT NULL, -- items returned by backends
+    results        INTEGER NOT NULL, -- items returned to the client
+    latency_ms     INTEGER NOT NULL,
+    error          TEXT              -- null if the search succeeded
+);
+
+CREATE INDEX search_log_searched_at ON search_log (searched_at);
+
+-- The outcome of each backend's part in a search that went to the backends
+CREATE TABLE search_log_backends
+(
+    search_log_id INTEGER NOT NULL REFERENCES search_log (id),
+    indexer_name  TEXT    NOT NULL,
+    outcome       TEXT    NOT NULL, -- hit, miss, error, or skip if the search cache ruled it out
+    results       INTEGER NOT NULL,
+    latency_ms    INTEGER NOT NULL,
+    PRIMARY KEY (search_log_id, indexer_name)
+);
@@ -0,0 +1,9 @@
+-- Find expired items by backend, source and when they were first stored, and
+-- delete their attrs along with them
+CREATE INDEX feed_items_retention ON feed_items (indexer_name, source, created_at);
+CREATE INDEX feed_item_meta_feed_item_id ON feed_item_meta (feed_item_id);
+
+-- Let the space freed by pruning be returned with incremental_vacuum. The
+-- change only takes effect after a full VACUUM.
+PRAGMA auto_vacuum = INCREMENTAL;
+VACUUM;
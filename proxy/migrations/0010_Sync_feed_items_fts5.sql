@@ -0,0 +1,35 @@
+-- Rebuild the search index as an external content table over feed_items,
+-- keyed by item id, and keep it in step with every insert, update and delete
+DROP TRIGGER feed_items_fts5_populate;
+DROP TABLE feed_items_fts5;
+
+CREATE VIRTUAL TABLE feed_items_fts5 USING fts5
+(
+    title,
+    content = 'feed_items',
+    content_rowid = 'id'
+);
+
+CREATE TRIGGER feed_items_fts5_insert
+    AFTER INSERT
+    ON feed_items
+BEGIN
+    INSERT INTO feed_items_fts5(rowid, title) VALUES (NEW.id, NEW.title);
+END;
+
+CREATE TRIGGER feed_items_fts5_delete
+    AFTER DELETE
+    ON feed_items
+BEGIN
+    INSERT INTO feed_items_fts5(feed_items_fts5, rowid, title) VALUES ('delete', OLD.id, OLD.title);
+END;
+
+CREATE TRIGGER feed_items_fts5_update
+    AFTER UPDATE OF id, title
+    ON feed_items
+BEGIN
+    INSERT INTO feed_items_fts5(feed_items_fts5, rowid, title) VALUES ('delete', OLD.id, OLD.title);
+    INSERT INTO feed_items_fts5(rowid, title) VALUES (NEW.id, NEW.title);
+END;
+
+INSERT INTO feed_items_fts5(feed_items_fts5) VALUES ('rebuild');
@@ -1,12 +1,19 @@
 package proxy
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/release"
 )
 
 type FeedItemSource string
@@ -16,18 +23,24 @@ const (
 	FeedItemSourceSearch FeedItemSource = "search"
 )
 
+// FeedItem is an item from a backend. Link and NZBLink are the upstream
+// links, which usually carry the indexer's API key, so they are left out of
+// JSON.
 type FeedItem struct {
-	UUID            string
-	IndexerName     string
-	Title           string
-	GUID            string
-	GUIDIsPermalink bool
-	Link            string
-	PubDate         time.Time
-	NZBLink         string
-	Size            int64
-	Source          FeedItemSource
-	Attrs           map[string]string
+	UUID            string            `json:"id"`
+	IndexerName     string            `json:"indexerName"`
+	Title           string            `json:"title"`
+	GUID            string            `json:"guid"`
+	GUIDIsPermalink bool              `json:"guidIsPermalink"`
+	Link            string            `json:"-"`
+	PubDate         time.Time         `json:"pubDate"`
+	NZBLink         string            `json:"-"`
+	Size            int64             `json:"size"`
+	Source          FeedItemSource    `json:"source"`
+	Attrs           map[string]string `json:"attrs"`
+	// Categories lists every category attr the item has, as newznab items
+	// may have several. Attrs holds only the last of them.
+	Categories []string `json:"categories,omitempty"`
 }
 
 func FeedItemFromNewznab(i newznab.Item, indexer string, source FeedItemSource) FeedItem {
@@ -35,6 +48,17 @@ func FeedItemFromNewznab(i newznab.Item, indexer string, source FeedItemSource)
 	sum := sha256.Sum256([]byte(concat))
 	id := hex.EncodeToString(sum[:])
 
+	// Attrs supplied by the indexer take precedence over those parsed from
+	// the title.
+	attrs := release.Parse(i.Title).Attrs()
+	maps.Copy(attrs, i.AttrsMap())
+	var categories []string
+	for _, a := range i.Attrs {
+		if a.Name == "category" {
+			categories = append(categories, a.Value)
+		}
+	}
+
 	return FeedItem{
 		UUID:            id,
 		IndexerName:     indexer,
@@ -46,26 +70,86 @@ func FeedItemFromNewznab(i newznab.Item, indexer string, source FeedItemSource)
 		NZBLink:         i.Enclosure.URL,
 		Size:            i.Enclosure.Length,
 		Source:          source,
-		Attrs:           i.AttrsMap(),
+		Attrs:           attrs,
+		Categories:      categories,
+	}
+}
+
+// categories returns every category the item has.
+func (fi FeedItem) categories() []string {
+
+	if len(fi.Categories) > 0 {
+		return fi.Categories
+	}
+	if c, ok := fi.Attrs["category"]; ok {
+		return []string{c}
+	}
+	return nil
+}
+
+// RemoteID returns the id the originating indexer uses for this item, which is
+// the newznab guid attr where present and otherwise the last path segment of
+// the GUID.
+func (fi FeedItem) RemoteID() string {
+
+	if id, ok := fi.Attrs["guid"]; ok && id != "" {
+		return id
 	}
+	return path.Base(strings.TrimRight(fi.GUID, "/"))
+}
+
+// LinkRewriter points item links at the proxy rather than the indexer.
+type LinkRewriter struct {
+	Host string
+	Port uint16
+	TLS  bool
+	// BasePath is prefixed to the path of rewritten links.
+	BasePath string
+	// Signer, if set, signs rewritten links.
+	Signer *newznab.LinkSigner
+	// APIKey is added to rewritten links that aren't signed, so that they can
+	// be fetched from a server that validates API keys.
+	APIKey string
+}
+
+// forRequest returns a copy of lr that adds the API key the request in ctx
+// was made with to links, unless they are signed.
+func (lr LinkRewriter) forRequest(ctx context.Context) LinkRewriter {
+	if lr.Signer == nil {
+		lr.APIKey = newznab.APIKeyFromContext(ctx)
+	}
+	return lr
+}
+
+// WithBasePath returns a copy of lr that prefixes links with basePath.
+func (lr LinkRewriter) WithBasePath(basePath string) LinkRewriter {
+	lr.BasePath = basePath
+	return lr
 }
 
-func (fi FeedItem) RewrittenNZBLink(host string, port uint16, tls bool) string {
+func (fi FeedItem) RewrittenNZBLink(lr LinkRewriter) string {
 
 	proto := "http"
-	if tls {
+	if lr.TLS {
 		proto = "https"
 	}
-	if port != 0 && port != 80 {
-		host = fmt.Sprintf("%s:%d", host, port)
+	host := lr.Host
+	if lr.Port != 0 && lr.Port != 80 {
+		host = fmt.Sprintf("%s:%d", host, lr.Port)
 	}
-	return fmt.Sprintf("%s://%s/getnzb/%s", proto, host, fi.UUID)
+	link := fmt.Sprintf("%s://%s%s/getnzb/%s", proto, host, lr.BasePath, fi.UUID)
+	if lr.Signer != nil {
+		link += "?" + lr.Signer.Sign(fi.UUID).Encode()
+	} else if lr.APIKey != "" {
+		link += "?" + url.Values{"apikey": {lr.APIKey}}.Encode()
+	}
+	return link
 }
 
-func (fi FeedItem) ToRewrittenNewznabItem(host string, port uint16, tls bool) newznab.Item {
+func (fi FeedItem) ToRewrittenNewznabItem(lr LinkRewriter) newznab.Item {
 
 	ret := fi.ToNewznabItem()
-	rewriteLink := fi.RewrittenNZBLink(host, port, tls)
+	rewriteLink := fi.RewrittenNZBLink(lr)
 	ret.Enclosure.URL = rewriteLink
 	ret.Link = rewriteLink
 	return ret
@@ -89,10 +173,27 @@ func (fi FeedItem) ToNewznabItem() newznab.Item {
 			Length: fi.Size,
 			Type:   "application/x-nzb",
 		},
-		Attrs: newznab.AttrsFromMap(fi.Attrs),
+		Attrs: fi.newznabAttrs(),
 	}
 }
 
+func (fi FeedItem) newznabAttrs() []newznab.NewznabAttr {
+
+	if len(fi.Categories) <= 1 {
+		return newznab.AttrsFromMap(fi.Attrs)
+	}
+	attrs := maps.Clone(fi.Attrs)
+	delete(attrs, "category")
+	ret := newznab.AttrsFromMap(attrs)
+	for _, c := range fi.Categories {
+		ret = append(ret, newznab.NewznabAttr{Name: "category", Value: c})
+	}
+	slices.SortStableFunc(ret, func(a, b newznab.NewznabAttr) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return ret
+}
+
 type SearchResultStatus string
 
 const (
@@ -110,12 +211,22 @@ func (srs SearchResultStatus) ShouldNotRequery() bool {
 }
 
 type SearchCacheEntry struct {
-	IndexerName        string
-	Query              string
-	FirstTried         time.Time
-	LastTried          time.Time
-	SearchResultStatus SearchResultStatus
-	ErrorMessage       string
+	IndexerName        string             `json:"indexerName"`
+	Query              string             `json:"query"`
+	FirstTried         time.Time          `json:"firstTried"`
+	LastTried          time.Time          `json:"lastTried"`
+	SearchResultStatus SearchResultStatus `json:"status"`
+	ErrorMessage       string             `json:"errorMessage,omitempty"`
+}
+
+// SearchCacheQuery filters search cache entries. Empty fields match
+// everything, and Query matches any query containing it.
+type SearchCacheQuery struct {
+	IndexerName string
+	Status      SearchResultStatus
+	Query       string
+	Limit       int
+	Offset      int
 }
 
 type NZBData struct {
@@ -123,3 +234,244 @@ type NZBData struct {
 	IndexerName string
 	URL         string
 }
+
+// RecentFeedItemsQuery selects stored items for RSS. Empty Indexers or
+// Categories match everything.
+type RecentFeedItemsQuery struct {
+	Indexers   []string
+	Categories []string
+	Limit      int
+	Offset     int
+}
+
+// ExpiredFeedItemsQuery selects the items of a backend from a source that
+// were first stored before a given time.
+type ExpiredFeedItemsQuery struct {
+	IndexerName string
+	Source      FeedItemSource
+	Before      time.Time
+	// KeepGrabbed excludes items that were grabbed successfully.
+	KeepGrabbed bool
+}
+
+// FeedPollState records the newest item seen on an RSS feed.
+type FeedPollState struct {
+	IndexerName string
+	FeedName    string
+	LastGUID    string
+	LastPubDate time.Time
+	// OffsetUnsupported is set once the feed is found to ignore the offset
+	// parameter, after which polls no longer try to page.
+	OffsetUnsupported bool
+	UpdatedAt         time.Time
+}
+
+// FeedPollRun records the outcome of a single RSS poll.
+type FeedPollRun struct {
+	ID          int64     `json:"id"`
+	IndexerName string    `json:"indexerName"`
+	FeedName    string    `json:"feedName"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	ItemsSeen   int       `json:"itemsSeen"`
+	ItemsNew    int       `json:"itemsNew"`
+	// HTTPStatus is 0 if no response was received.
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FeedStatus is the rolling status of an RSS feed.
+type FeedStatus struct {
+	IndexerName string `json:"indexerName"`
+	FeedName    string `json:"feedName"`
+	// Schedule describes how often the feed is polled.
+	Schedule            string       `json:"schedule"`
+	LastRun             *FeedPollRun `json:"lastRun,omitempty"`
+	LastSuccess         *time.Time   `json:"lastSuccess,omitempty"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	// NextPoll is nil if the feed isn't being polled.
+	NextPoll *time.Time `json:"nextPoll,omitempty"`
+}
+
+// APIKey is a key accepted by the newznab API.
+type APIKey struct {
+	Key       string     `json:"key"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// DBStats counts the rows in the main tables of the store.
+type DBStats struct {
+	FeedItems          int                `json:"feedItems"`
+	FeedItemMeta       int                `json:"feedItemMeta"`
+	SearchCacheEntries int                `json:"searchCacheEntries"`
+	FeedPollRuns       int                `json:"feedPollRuns"`
+	APIKeys            int                `json:"apiKeys"`
+	ItemsByIndexer     []IndexerItemCount `json:"itemsByIndexer"`
+}
+
+type IndexerItemCount struct {
+	IndexerName string         `json:"indexerName"`
+	Source      FeedItemSource `json:"source"`
+	Items       int            `json:"items"`
+}
+
+// SearchIndexStatus is the outcome of checking the search index against the
+// items it indexes.
+type SearchIndexStatus struct {
+	OK bool `json:"ok"`
+	// Error describes the inconsistency found, if any.
+	Error   string `json:"error,omitempty"`
+	Items   int    `json:"items"`
+	Indexed int    `json:"indexed"`
+}
+
+// Grab is a record of an NZB fetched through the proxy.
+type Grab struct {
+	ID          int64  `json:"id"`
+	FeedItemID  string `json:"feedItemId"`
+	IndexerName string `json:"indexerName"`
+	Title       string `json:"title"`
+	// APIKey is empty if the grab was made without one, e.g. by signed link.
+	// It is never serialised, so that the grab history doesn't leak keys.
+	APIKey string `json:"-"`
+	// APIKeyName is the name of APIKey, if it is a managed key.
+	APIKeyName string    `json:"apiKeyName,omitempty"`
+	GrabbedAt  time.Time `json:"grabbedAt"`
+	Size       int       `json:"size"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// GrabQuery filters the grab history. Zero values match everything.
+type GrabQuery struct {
+	IndexerName string
+	FeedItemID  string
+	// APIKey matches either the key or its name.
+	APIKey string
+	// Title matches grabs whose title contains it.
+	Title string
+	// Succeeded, if set, matches only successful or only failed grabs.
+	Succeeded *bool
+	Since     time.Time
+	Limit     int
+	Offset    int
+}
+
+// GrabStats summarises the grabs made from an indexer.
+type GrabStats struct {
+	IndexerName string    `json:"indexerName"`
+	Grabs       int       `json:"grabs"`
+	Failed      int       `json:"failed"`
+	Bytes       int64     `json:"bytes"`
+	LastGrabbed time.Time `json:"lastGrabbed"`
+}
+
+// ReleaseGrabs answers whether a release has been grabbed before, from any
+// indexer.
+type ReleaseGrabs struct {
+	// Grabbed is true if any of Grabs succeeded.
+	Grabbed bool   `json:"grabbed"`
+	Grabs   []Grab `json:"grabs"`
+}
+
+// SearchLogEntry records a search received by the proxy. RSS sync searches
+// have an empty Query, and are left out of query stats.
+type SearchLogEntry struct {
+	ID         int64     `json:"id"`
+	SearchedAt time.Time `json:"searchedAt"`
+	// Feed is the virtual feed searched, or empty for the proxy itself.
+	Feed  string `json:"feed,omitempty"`
+	Query string `json:"query"`
+	// Params holds the other search params, URL-encoded.
+	Params string `json:"params,omitempty"`
+	// APIKey is never serialised, so that the search log doesn't leak keys.
+	APIKey string `json:"-"`
+	// APIKeyName is the name of APIKey, if it is a managed key.
+	APIKeyName string `json:"apiKeyName,omitempty"`
+	// LocalResults counts the stored items matching the query, and
+	// RemoteResults the items the backends returned if they were searched.
+	LocalResults  int                `json:"localResults"`
+	RemoteResults int                `json:"remoteResults"`
+	Results       int                `json:"results"`
+	LatencyMS     int64              `json:"latencyMs"`
+	Error         string             `json:"error,omitempty"`
+	Backends      []SearchLogBackend `json:"backends,omitempty"`
+}
+
+// SearchOutcomeSkip is the outcome of a backend that the search cache ruled
+// out of a search.
+const SearchOutcomeSkip = "skip"
+
+// SearchLogBackend records a backend's part in a search that went to the
+// backends. Outcome is a SearchResultStatus, or SearchOutcomeSkip.
+type SearchLogBackend struct {
+	IndexerName string `json:"indexerName"`
+	Outcome     string `json:"outcome"`
+	Results     int    `json:"results"`
+	LatencyMS   int64  `json:"latencyMs"`
+}
+
+// SearchLogQuery filters the search log. Zero values match everything.
+type SearchLogQuery struct {
+	// Query matches searches whose query contains it.
+	Query  string
+	Since  time.Time
+	Limit  int
+	Offset int
+}
+
+// QueryStats summarises the searches made with a query, compared without
+// regard to case.
+type QueryStats struct {
+	Query         string    `json:"query"`
+	Searches      int       `json:"searches"`
+	EmptySearches int       `json:"emptySearches"`
+	LastSearched  time.Time `json:"lastSearched"`
+}
+
+// BackendContribution summarises how a backend has contributed to the
+// searches that went to the backends.
+type BackendContribution struct {
+	IndexerName string `json:"indexerName"`
+	Searches    int    `json:"searches"`
+	Hits        int    `json:"hits"`
+	Misses      int    `json:"misses"`
+	Errors      int    `json:"errors"`
+	Skips       int    `json:"skips"`
+	Results     int    `json:"results"`
+	// HitRate is the share of the searches actually sent to the backend
+	// that found something.
+	HitRate float64 `json:"hitRate"`
+	// ResultShare is the backend's share of the results from all backends.
+	ResultShare  float64 `json:"resultShare"`
+	AvgLatencyMS float64 `json:"avgLatencyMs"`
+}
+
+// BackendStatus summarises the health of a backend from its recent searches
+// and RSS polls.
+type BackendStatus struct {
+	Name     string `json:"name"`
+	BaseURL  string `json:"baseUrl"`
+	Priority int    `json:"priority"`
+	// Healthy is false if any feed's last poll failed, or the backend's most
+	// recent search failed.
+	Healthy bool `json:"healthy"`
+	// Searches counts the outcomes of searches tried within the last day.
+	Searches     map[SearchResultStatus]int `json:"searches"`
+	LastError    string                     `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time                 `json:"lastErrorAt,omitempty"`
+	Feeds        int                        `json:"feeds"`
+	FailingFeeds int                        `json:"failingFeeds"`
+	Usage        BackendUsage               `json:"usage"`
+}
+
+// BackendUsage counts requests made to a backend within the last day. API
+// requests are approximate, as repeats of a search aren't recorded.
+type BackendUsage struct {
+	APIRequests int `json:"apiRequests"`
+	Grabs       int `json:"grabs"`
+	// APILimit and GrabLimit are the configured quotas, or 0 if unknown.
+	APILimit  int `json:"apiLimit,omitempty"`
+	GrabLimit int `json:"grabLimit,omitempty"`
+}
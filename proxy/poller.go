@@ -0,0 +1,364 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/henges/newznab-proxy/metrics"
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxCatchUpPages = 10
+	defaultOffsetParam     = "offset"
+)
+
+type pollResult struct {
+	itemsSeen  int
+	itemsNew   int
+	httpStatus int
+}
+
+func feedKey(indexer, feed string) string {
+	return indexer + "/" + feed
+}
+
+// poller is the goroutine polling one feed.
+type poller struct {
+	backend backend
+	feed    RSSFeed
+	// cancel stops the poller, aborting any poll in progress.
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// startPoller starts polling feed on sched, unless the pollers have been
+// stopped. p.pollersMu must be held.
+func (p *Proxy) startPoller(b backend, feed RSSFeed, sched *feedScheduler) {
+
+	if p.pollersStopped {
+		return
+	}
+	ctx, cancel := context.WithCancel(p.pollerCtx)
+	pl := &poller{
+		backend: b,
+		feed:    feed,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	p.pollers[feedKey(b.name, feed.Name)] = pl
+	p.pollerWg.Add(1)
+	go func() {
+		defer p.pollerWg.Done()
+		defer close(pl.stopped)
+		defer cancel()
+		delay := sched.initialDelay()
+		for {
+			p.setNextPoll(ctx, b, feed, scheduledPoll{at: time.Now().Add(delay), schedule: sched.describe()})
+			select {
+			case <-time.After(delay):
+				{
+					_, res, err := p.runPoll(ctx, b, feed)
+					if ctx.Err() != nil {
+						return
+					}
+					if err != nil {
+						slog.ErrorContext(ctx, "error polling feed", "backend", b.name, "feed", feed.Name, "err", err)
+					}
+					delay = sched.next(res, err)
+				}
+			case <-p.done:
+				{
+					return
+				}
+			case <-ctx.Done():
+				{
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopPoller cancels the poller for key, aborting any poll in progress, and
+// returns a channel that is closed once it has exited, or nil if there is no
+// such poller. p.pollersMu must be held, but need not be while waiting.
+func (p *Proxy) stopPoller(key string) <-chan struct{} {
+
+	pl, ok := p.pollers[key]
+	if !ok {
+		return nil
+	}
+	pl.cancel()
+	delete(p.pollers, key)
+	p.scheduleMu.Lock()
+	delete(p.nextPolls, key)
+	p.scheduleMu.Unlock()
+	return pl.stopped
+}
+
+// runPoll polls feed and records the run in the feed's history.
+func (p *Proxy) runPoll(ctx context.Context, b backend, feed RSSFeed) (FeedPollRun, pollResult, error) {
+
+	ctx, span := tracer.Start(ctx, "Proxy.PollFeed", trace.WithAttributes(
+		attribute.String("newznab.backend", b.name),
+		attribute.String("proxy.feed", feed.Name),
+	))
+	defer span.End()
+	started := time.Now()
+	res, pollErr := p.pollFeed(ctx, b, feed)
+	recordError(span, pollErr)
+	span.SetAttributes(attribute.Int("proxy.items_new", res.itemsNew))
+	run := FeedPollRun{
+		IndexerName: b.name,
+		FeedName:    feed.Name,
+		StartedAt:   started,
+		FinishedAt:  time.Now(),
+		ItemsSeen:   res.itemsSeen,
+		ItemsNew:    res.itemsNew,
+		HTTPStatus:  res.httpStatus,
+	}
+	if pollErr != nil {
+		run.Error = pollErr.Error()
+	}
+	metrics.Polls.WithLabelValues(b.name, feed.Name, metrics.Outcome(pollErr)).Inc()
+	metrics.PollDuration.WithLabelValues(b.name, feed.Name).Observe(run.FinishedAt.Sub(started).Seconds())
+	metrics.PollNewItems.WithLabelValues(b.name, feed.Name).Add(float64(res.itemsNew))
+	// The run is recorded even if the context was cancelled mid-poll.
+	err := p.s.InsertFeedPollRun(context.WithoutCancel(ctx), run)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording poll", "backend", b.name, "feed", feed.Name, "err", err)
+	}
+	return run, res, pollErr
+}
+
+// scheduledPoll is a snapshot of when a feed will next be polled.
+type scheduledPoll struct {
+	at       time.Time
+	schedule string
+}
+
+// setNextPoll records when feed will next be polled, unless its poller has
+// been stopped, in which case a replacement may already have recorded it.
+func (p *Proxy) setNextPoll(ctx context.Context, b backend, feed RSSFeed, next scheduledPoll) {
+
+	p.scheduleMu.Lock()
+	defer p.scheduleMu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	p.nextPolls[feedKey(b.name, feed.Name)] = next
+}
+
+// FeedStatuses returns the status of every configured RSS feed.
+func (p *Proxy) FeedStatuses(ctx context.Context) ([]FeedStatus, error) {
+
+	var ret []FeedStatus
+	for _, b := range p.current().backends {
+		if b.rssCfg == nil {
+			continue
+		}
+		for _, feed := range b.rssCfg.Feeds {
+			status, err := p.s.GetFeedStatus(ctx, b.name, feed.Name)
+			if err != nil {
+				return nil, err
+			}
+			status.Schedule = "every " + feed.PollInterval.String()
+			if feed.Cron != "" {
+				status.Schedule = "cron " + feed.Cron
+			}
+			p.scheduleMu.Lock()
+			if next, ok := p.nextPolls[feedKey(b.name, feed.Name)]; ok {
+				status.Schedule = next.schedule
+				status.NextPoll = &next.at
+			}
+			p.scheduleMu.Unlock()
+			ret = append(ret, status)
+		}
+	}
+	return ret, nil
+}
+
+// ErrNoSuchFeed is returned for a feed that is not configured.
+var ErrNoSuchFeed = errors.New("no such feed")
+
+// PollFeed polls a configured feed immediately, outside its schedule. If the
+// poll fails, the error is returned alongside the recorded run.
+func (p *Proxy) PollFeed(ctx context.Context, indexer, feed string) (FeedPollRun, error) {
+
+	var rssFeed RSSFeed
+	var ok bool
+	b, err := p.backendByName(indexer)
+	if err == nil && b.rssCfg != nil {
+		rssFeed, ok = lo.Find(b.rssCfg.Feeds, func(item RSSFeed) bool {
+			return item.Name == feed
+		})
+	}
+	if !ok {
+		return FeedPollRun{}, fmt.Errorf("%w: %s", ErrNoSuchFeed, feedKey(indexer, feed))
+	}
+	run, _, err := p.runPoll(ctx, *b, rssFeed)
+	return run, err
+}
+
+// FeedPollRuns returns the most recent limit polls of a feed, newest first.
+func (p *Proxy) FeedPollRuns(ctx context.Context, indexer, feed string, limit int) ([]FeedPollRun, error) {
+
+	return p.s.ListFeedPollRuns(ctx, indexer, feed, limit)
+}
+
+// pollFeed reads feed from its newest item backwards, a page at a time, until
+// it reaches the last item seen by a previous poll, inserting any that are
+// new. The first poll of a feed only reads one page, as does any poll of a
+// feed that has been found not to support paging. Polling stops early if the
+// indexer reports a page as not modified. The last item seen only moves on
+// once a poll has reached it, so a poll that stops short is retried in full.
+func (p *Proxy) pollFeed(ctx context.Context, b backend, feed RSSFeed) (pollResult, error) {
+
+	var res pollResult
+	params := make(map[string]string, len(b.rssCfg.RSSQueryParams)+len(feed.QueryParams)+1)
+	maps.Copy(params, b.rssCfg.RSSQueryParams)
+	maps.Copy(params, feed.QueryParams)
+
+	state, err := p.s.GetFeedPollState(ctx, b.name, feed.Name)
+	firstPoll := errors.Is(err, sql.ErrNoRows)
+	if err != nil && !firstPoll {
+		return res, err
+	}
+	state.IndexerName = b.name
+	state.FeedName = feed.Name
+
+	maxPages := cmp.Or(feed.MaxCatchUpPages, defaultMaxCatchUpPages)
+	if firstPoll || state.OffsetUnsupported {
+		maxPages = 1
+	}
+	offsetParam := cmp.Or(feed.OffsetParam, defaultOffsetParam)
+
+	var newest *newznab.Item
+	var firstGUID string
+	// The pages' validators are committed once the whole poll has succeeded,
+	// so that a poll failing partway reads every page again next time.
+	var validators []newznab.RSSValidators
+	caughtUp := false
+	offset := 0
+	for page := 0; page < maxPages && !caughtUp; page++ {
+		if page > 0 {
+			params[offsetParam] = strconv.Itoa(offset)
+		}
+		rss, v, err := b.client.PollRSS(ctx, b.rssCfg.RSSPath, params)
+		if errors.Is(err, newznab.ErrNotModified) {
+			// Nothing has changed since this page was last read, so there is
+			// nothing new on it or beyond it.
+			if page == 0 {
+				res.httpStatus = http.StatusNotModified
+			}
+			caughtUp = true
+			break
+		}
+		if err != nil {
+			var statusErr newznab.StatusError
+			if errors.As(err, &statusErr) {
+				res.httpStatus = statusErr.StatusCode
+			}
+			return res, err
+		}
+		res.httpStatus = http.StatusOK
+		validators = append(validators, v)
+		items := rss.Channel.Items
+		if len(items) == 0 {
+			caughtUp = true
+			break
+		}
+		if page == 0 {
+			newest = &items[0]
+			firstGUID = items[0].GUID.Value
+		} else if items[0].GUID.Value == firstGUID {
+			slog.WarnContext(ctx, "offset parameter is ignored, disabling catch-up", "backend", b.name, "feed", feed.Name, "param", offsetParam)
+			state.OffsetUnsupported = true
+			caughtUp = true
+			break
+		}
+		for i := range items {
+			if time.Time(items[i].PubDate).After(time.Time(newest.PubDate)) {
+				newest = &items[i]
+			}
+		}
+
+		res.itemsSeen += len(items)
+		inserted, err := p.ingestRSSPage(ctx, b, items)
+		if err != nil {
+			return res, err
+		}
+		res.itemsNew += inserted
+		// Items stored by a search or an earlier failed poll don't mean the
+		// feed has been caught up with, so only the saved position counts.
+		caughtUp = firstPoll || state.reachedBy(items)
+		offset += len(items)
+	}
+	if !caughtUp {
+		slog.WarnContext(ctx, "stopped without reaching the last seen item, the next poll will try again",
+			"backend", b.name, "feed", feed.Name, "pages", maxPages)
+	} else if newest != nil {
+		state.LastGUID = newest.GUID.Value
+		state.LastPubDate = time.Time(newest.PubDate)
+	}
+	state.UpdatedAt = time.Now()
+	err = p.s.UpsertFeedPollState(ctx, state)
+	if err != nil {
+		return res, err
+	}
+	b.client.CommitRSSValidators(validators...)
+	return res, nil
+}
+
+// reachedBy reports whether items include or predate the last item seen.
+func (s FeedPollState) reachedBy(items []newznab.Item) bool {
+
+	if s.LastGUID == "" {
+		return false
+	}
+	for _, item := range items {
+		if item.GUID.Value == s.LastGUID || !time.Time(item.PubDate).After(s.LastPubDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestRSSPage inserts the items not already stored that pass the filters.
+func (p *Proxy) ingestRSSPage(ctx context.Context, b backend, items []newznab.Item) (int, error) {
+
+	feedItems := lo.Map(items, func(item newznab.Item, index int) FeedItem {
+		return FeedItemFromNewznab(item, b.name, FeedItemSourceRSS)
+	})
+	ids := lo.Map(feedItems, func(item FeedItem, index int) string {
+		return item.UUID
+	})
+	existingIDs, err := p.s.GetFeedItemUUIDs(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	inserted := 0
+	for _, fi := range p.current().filters.apply(feedItems, "") {
+		if _, ok := existingIDs[fi.UUID]; ok {
+			continue
+		}
+		err = p.s.InsertFeedItem(ctx, fi)
+		if err != nil {
+			return inserted, err
+		}
+		inserted++
+	}
+	return inserted, nil
+}
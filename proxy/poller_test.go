@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFeed serves items newest first, two to a page, with an ETag per page.
+type testFeed struct {
+	mu        sync.Mutex
+	items     []newznab.Item
+	failPages bool
+}
+
+func (f *testFeed) add(n int) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for range n {
+		id := strconv.Itoa(len(f.items) + 1)
+		f.items = append([]newznab.Item{{
+			Title:   "Some.Show.S01E" + id,
+			GUID:    newznab.RssGuid{Value: id},
+			PubDate: newznab.RFC1123Time(time.Now().Add(time.Duration(len(f.items)) * time.Minute).Truncate(time.Second)),
+		}}, f.items...)
+	}
+}
+
+func (f *testFeed) setFailPages(fail bool) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failPages = fail
+}
+
+func (f *testFeed) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if f.failPages && offset > 0 {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf(`"%d-%d"`, offset, len(f.items))
+	if r.Header.Get("If-None-Match") == etag {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	items := f.items[min(offset, len(f.items)):min(offset+2, len(f.items))]
+	body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(offset, len(items), items))
+	rw.Header().Set("ETag", etag)
+	rw.Write(body)
+}
+
+func TestProxy_pollFeedCatchUp(t *testing.T) {
+
+	ctx := context.Background()
+	feed := &testFeed{}
+	feed.add(2)
+	srv := httptest.NewServer(feed)
+	defer srv.Close()
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"), "tv")
+	c.Backends[0].BaseURL = srv.URL
+	p, err := NewProxy(ctx, c)
+	require.NoError(t, err)
+	b := p.current().backends[0]
+	poll := func() (pollResult, error) {
+		return p.pollFeed(ctx, b, b.rssCfg.Feeds[0])
+	}
+
+	res, err := poll()
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.itemsNew)
+
+	// An item a search already stored doesn't end catch-up, and neither does
+	// a page stored by a poll that then failed.
+	feed.add(3)
+	require.NoError(t, p.s.InsertFeedItem(ctx, FeedItemFromNewznab(feed.items[0], "a", FeedItemSourceSearch)))
+	feed.setFailPages(true)
+	_, err = poll()
+	require.Error(t, err)
+	feed.setFailPages(false)
+	res, err = poll()
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.itemsNew)
+	assert.Equal(t, http.StatusOK, res.httpStatus)
+	stored, err := p.s.SearchForFeedItem(ctx, "some show")
+	require.NoError(t, err)
+	assert.Len(t, stored, 5)
+	state, err := p.s.GetFeedPollState(ctx, "a", "tv")
+	require.NoError(t, err)
+	assert.Equal(t, "5", state.LastGUID)
+
+	res, err = poll()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, res.httpStatus)
+}
@@ -1,26 +1,46 @@
 package proxy
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"maps"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/henges/newznab-proxy/metrics"
 	"github.com/henges/newznab-proxy/newznab"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Proxy struct {
-	c        *Config
-	s        *Store
-	backends []backend
+	s     *Store
+	links LinkRewriter
+	// set holds everything built from the backend config, which is swapped
+	// out as a whole on reload.
+	set atomic.Pointer[backendSet]
+
+	virtualFeeds []*VirtualFeed
 
 	pollerWg     *sync.WaitGroup
+	pollerCtx    context.Context
 	pollerCancel func()
 	done         chan struct{}
+	pollersMu    sync.Mutex
+	pollers      map[string]*poller
+	scheduleMu   sync.Mutex
+	nextPolls    map[string]scheduledPoll
+
+	// pollersStopped is set once StopRSSPolls has been called, after which
+	// no pollers are started. It is guarded by pollersMu.
+	pollersStopped bool
 }
 
 var _ newznab.ServerImplementation = (*Proxy)(nil)
@@ -31,103 +51,174 @@ type backend struct {
 	rssCfg *RSSConfig
 }
 
-func NewProxy(ctx context.Context, c *Config) (*Proxy, error) {
-	db, err := NewStore(ctx, c.Storage.DBPath)
+// backendSet is the state built from a Config's backends, filters and ranking
+// profiles. A request uses the same set throughout, so a reload does not
+// affect requests in flight.
+type backendSet struct {
+	c          *Config
+	backends   []backend
+	filters    filters
+	ranker     *ranker
+	schedulers map[string]*feedScheduler
+}
+
+// newBackendSet builds a backendSet from c. Clients are reused from prev, if
+// given, for backends whose URL and API key are unchanged.
+func newBackendSet(c *Config, prev *backendSet) (*backendSet, error) {
+
+	filters, err := newFilters(c.Filters)
 	if err != nil {
 		return nil, err
 	}
-	backends := make([]backend, 0, len(c.Backends))
+	ranker, err := newRanker(c)
+	if err != nil {
+		return nil, err
+	}
+	ret := &backendSet{
+		c:          c,
+		backends:   make([]backend, 0, len(c.Backends)),
+		filters:    filters,
+		ranker:     ranker,
+		schedulers: make(map[string]*feedScheduler),
+	}
 	for _, bcfg := range c.Backends {
-		cl := newznab.NewClient(bcfg.BaseURL, bcfg.APIKey)
-		backends = append(backends, backend{
+		if _, err := ret.backendByName(bcfg.Name); err == nil {
+			return nil, fmt.Errorf("backend %s is configured more than once", bcfg.Name)
+		}
+		var cl *newznab.Client
+		if prev != nil {
+			if old, ok := prev.backendConfig(bcfg.Name); ok && old.BaseURL == bcfg.BaseURL && old.APIKey == bcfg.APIKey {
+				b, _ := prev.backendByName(bcfg.Name)
+				cl = b.client
+			}
+		}
+		if cl == nil {
+			cl = newznab.NewClient(bcfg.BaseURL, bcfg.APIKey, newznab.WithName(bcfg.Name))
+		}
+		ret.backends = append(ret.backends, backend{
 			name:   bcfg.Name,
 			client: cl,
 			rssCfg: bcfg.RSS,
 		})
+		if bcfg.RSS == nil {
+			continue
+		}
+		for _, feed := range bcfg.RSS.Feeds {
+			sched, err := newFeedScheduler(feed)
+			if err != nil {
+				return nil, fmt.Errorf("backend %s: %w", bcfg.Name, err)
+			}
+			ret.schedulers[feedKey(bcfg.Name, feed.Name)] = sched
+		}
 	}
-	return &Proxy{
-		c:        c,
-		s:        db,
-		backends: backends,
-		pollerWg: &sync.WaitGroup{},
-	}, nil
+	return ret, nil
 }
 
+func (s *backendSet) backendConfig(name string) (BackendConfig, bool) {
+
+	return lo.Find(s.c.Backends, func(item BackendConfig) bool {
+		return item.Name == name
+	})
+}
+
+func (s *backendSet) backendByName(name string) (*backend, error) {
+
+	for _, b := range s.backends {
+		if b.name == name {
+			return &b, nil
+		}
+	}
+	return nil, newznab.ServerError{
+		Code:        400,
+		Description: "the indexer that provided this NZB is no longer configured: " + name,
+	}
+}
+
+func NewProxy(ctx context.Context, c *Config) (*Proxy, error) {
+	set, err := newBackendSet(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewStore(ctx, c.Storage.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	var signer *newznab.LinkSigner
+	if c.Web.LinkSecret != "" {
+		signer = newznab.NewLinkSigner([]byte(c.Web.LinkSecret), cmp.Or(c.Web.LinkTTL, defaultLinkTTL))
+	}
+	p := &Proxy{
+		s: db,
+		links: LinkRewriter{
+			Host:   c.Web.ExternalHost,
+			Port:   c.Web.Port,
+			TLS:    c.Web.TLS,
+			Signer: signer,
+		},
+		pollerWg:  &sync.WaitGroup{},
+		pollers:   make(map[string]*poller),
+		nextPolls: make(map[string]scheduledPoll),
+	}
+	p.set.Store(set)
+	for _, vfc := range c.VirtualFeeds {
+		vf, err := newVirtualFeed(p, vfc)
+		if err != nil {
+			return nil, err
+		}
+		p.virtualFeeds = append(p.virtualFeeds, vf)
+	}
+	return p, nil
+}
+
+const defaultLinkTTL = time.Hour * 24
+
+func (p *Proxy) VirtualFeeds() []*VirtualFeed {
+	return p.virtualFeeds
+}
+
+// LinkSigner returns the signer used for rewritten NZB links, or nil if link
+// signing is not configured.
+func (p *Proxy) LinkSigner() *newznab.LinkSigner {
+	return p.links.Signer
+}
+
+// current returns the backend set in use.
+func (p *Proxy) current() *backendSet {
+	return p.set.Load()
+}
+
+// StartRSSPolls starts polling each backend's RSS feeds, and the job that
+// prunes expired items.
 func (p *Proxy) StartRSSPolls(ctx context.Context) {
 
-	ctx, p.pollerCancel = context.WithCancel(ctx)
+	p.pollersMu.Lock()
+	defer p.pollersMu.Unlock()
+	p.pollerCtx, p.pollerCancel = context.WithCancel(ctx)
 	p.done = make(chan struct{})
-	for _, b := range p.backends {
+	p.pollersStopped = false
+	set := p.current()
+	for _, b := range set.backends {
 		if b.rssCfg == nil {
 			continue
 		}
 		for _, feed := range b.rssCfg.Feeds {
-			params := maps.Clone(b.rssCfg.RSSQueryParams)
-			maps.Copy(params, feed.QueryParams)
-			p.pollerWg.Add(1)
-			go func() {
-				defer p.pollerWg.Done()
-				poll := func() error {
-					items, err := b.client.PollRSS(ctx, b.rssCfg.RSSPath, params)
-					if err != nil {
-						return err
-					}
-					feedItems := lo.Map(items.Channel.Items, func(item newznab.Item, index int) FeedItem {
-						return FeedItemFromNewznab(item, b.name, FeedItemSourceRSS)
-					})
-					ids := lo.Map(feedItems, func(item FeedItem, index int) string {
-						return item.UUID
-					})
-					existingIDs, err := p.s.GetFeedItemUUIDs(ctx, ids)
-					if err != nil {
-						return err
-					}
-					for _, fi := range feedItems {
-						if _, ok := existingIDs[fi.UUID]; ok {
-							continue
-						}
-						err = p.s.InsertFeedItem(ctx, fi)
-						if err != nil {
-							return err
-						}
-					}
-					return nil
-				}
-				var err error
-				err = poll()
-				if err != nil {
-					fmt.Printf("%s feed %s: error polling: %s", b.name, feed.Name, err)
-				}
-
-				for {
-					select {
-					case <-time.After(feed.PollInterval):
-						{
-							err = poll()
-							if err != nil {
-								fmt.Printf("%s feed %s: error polling: %s", b.name, feed.Name, err)
-							}
-						}
-					case <-p.done:
-						{
-							return
-						}
-					case <-ctx.Done():
-						{
-							return
-						}
-					}
-				}
-			}()
+			p.startPoller(b, feed, set.schedulers[feedKey(b.name, feed.Name)])
 		}
 	}
+	p.startPruner()
 }
 
+// StopRSSPolls stops the pollers and pruner, waiting for them to exit. It
+// may be called more than once.
 func (p *Proxy) StopRSSPolls() error {
-	if p.pollerCancel == nil {
+	p.pollersMu.Lock()
+	if p.pollerCancel == nil || p.pollersStopped {
+		p.pollersMu.Unlock()
 		return nil
 	}
+	p.pollersStopped = true
 	close(p.done)
+	p.pollersMu.Unlock()
 	done := make(chan struct{}, 1)
 	go func() {
 		p.pollerWg.Wait()
@@ -149,9 +240,10 @@ func (p *Proxy) StopRSSPolls() error {
 	}
 }
 
-func feedItemsToRssFeed(fis []FeedItem, host string, port uint16, tls bool) *newznab.RssFeed {
+func feedItemsToRssFeed(ctx context.Context, fis []FeedItem, lr LinkRewriter) *newznab.RssFeed {
+	lr = lr.forRequest(ctx)
 	newzItems := lo.Map(fis, func(item FeedItem, index int) newznab.Item {
-		return item.ToRewrittenNewznabItem(host, port, tls)
+		return item.ToRewrittenNewznabItem(lr)
 	})
 	ret := newznab.NewRssFeedFromItems(0, len(newzItems), newzItems)
 	return &ret
@@ -159,15 +251,116 @@ func feedItemsToRssFeed(fis []FeedItem, host string, port uint16, tls bool) *new
 
 const requeryThreshold = time.Hour * 24
 
+const (
+	defaultRSSLimit = 100
+	maxRSSLimit     = 500
+)
+
+func (p *Proxy) RSS(ctx context.Context, params newznab.RSSParams) (*newznab.RssFeed, error) {
+
+	return p.recent(ctx, RecentFeedItemsQuery{
+		Indexers:   splitList(params.Backend),
+		Categories: splitList(params.Category),
+		Limit:      params.Limit,
+		Offset:     params.Offset,
+	}, params.Sort, p.links)
+}
+
+// recent serves the newest stored items, as used by RSS sync, ordered by sort
+// if it is set. Items must pass both the global filters and any in extra.
+func (p *Proxy) recent(ctx context.Context, q RecentFeedItemsQuery, sort string, lr LinkRewriter, extra ...filters) (*newznab.RssFeed, error) {
+
+	if err := checkSort(sort); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultRSSLimit
+	}
+	q.Limit = min(q.Limit, maxRSSLimit)
+	items, err := p.s.ListRecentFeedItems(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := newznab.APIKeyFromContext(ctx)
+	items = p.current().filters.apply(items, apiKey)
+	for _, f := range extra {
+		items = f.apply(items, apiKey)
+	}
+	if sort != "" {
+		if err := sortItems(items, sort); err != nil {
+			return nil, err
+		}
+	}
+	ret := feedItemsToRssFeed(ctx, items, lr)
+	ret.Channel.Response.Offset = q.Offset
+	return ret, nil
+}
+
+// splitList splits a comma-delimited parameter, dropping empty entries.
+func splitList(s string) []string {
+
+	return lo.Compact(lo.Map(strings.Split(s, ","), func(item string, index int) string {
+		return strings.TrimSpace(item)
+	}))
+}
+
 func (p *Proxy) Search(ctx context.Context, params newznab.SearchParams) (*newznab.RssFeed, error) {
+
+	if err := checkSort(params.Sort); err != nil {
+		return nil, err
+	}
+	// An empty query is how *arr RSS sync asks for the latest releases.
+	if strings.TrimSpace(params.Query) == "" {
+		entry := SearchLogEntry{SearchedAt: time.Now()}
+		ret, err := p.recent(ctx, RecentFeedItemsQuery{
+			Categories: splitList(params.Category),
+			Limit:      params.Limit,
+			Offset:     params.Offset,
+		}, params.Sort, p.links)
+		if ret != nil {
+			entry.LocalResults = len(ret.Channel.Items)
+		}
+		p.logSearch(ctx, params, entry, ret, err)
+		return ret, err
+	}
+	ctx, span := tracer.Start(ctx, "Proxy.Search", trace.WithAttributes(
+		attribute.String("newznab.query", params.Query),
+		attribute.String("newznab.cat", params.Category),
+	))
+	defer span.End()
+	entry := SearchLogEntry{SearchedAt: time.Now()}
+	ret, err := p.search(ctx, span, params, &entry)
+	recordError(span, err)
+	p.logSearch(ctx, params, entry, ret, err)
+	return ret, err
+}
+
+// search answers a search from the stored items if any match, and otherwise
+// from the backends, recording what happened in entry.
+func (p *Proxy) search(ctx context.Context, span trace.Span, params newznab.SearchParams, entry *SearchLogEntry) (*newznab.RssFeed, error) {
+
+	set := p.current()
+	apiKey := newznab.APIKeyFromContext(ctx)
 	matches, err := p.s.SearchForFeedItem(ctx, params.Query)
 	if err != nil {
 		return nil, err
 	}
+	matches = set.filters.apply(matches, apiKey)
+	entry.LocalResults = len(matches)
 	if len(matches) > 0 {
-		return feedItemsToRssFeed(matches, p.c.Web.ExternalHost, p.c.Web.Port, p.c.Web.TLS), nil
+		metrics.Searches.WithLabelValues("local").Inc()
+		span.SetAttributes(attribute.String("proxy.source", "local"), attribute.Int("proxy.results", len(matches)))
+		relevance := make(map[string]float64, len(matches))
+		positionalRelevance(matches, relevance)
+		err = set.order(matches, params, relevance, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		return feedItemsToRssFeed(ctx, matches, p.links), nil
 	}
 
+	metrics.Searches.WithLabelValues("remote").Inc()
+	span.SetAttributes(attribute.String("proxy.source", "remote"))
 	params = params.WithSanitisedQuery()
 	searchCache, err := p.s.LoadSearchCacheEntriesForQuery(ctx, params.Query)
 	if err != nil {
@@ -178,9 +371,10 @@ func (p *Proxy) Search(ctx context.Context, params newznab.SearchParams) (*newzn
 		skipped bool
 		err     error
 		vals    []FeedItem
+		latency time.Duration
 	}
-	results := make([]result, len(p.backends))
-	for i, b := range p.backends {
+	results := make([]result, len(set.backends))
+	for i, b := range set.backends {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -189,29 +383,39 @@ func (p *Proxy) Search(ctx context.Context, params newznab.SearchParams) (*newzn
 				results[i] = result{skipped: true}
 				return
 			}
+			start := time.Now()
 			searchRes, err := b.client.Search(ctx, params)
 			if err != nil {
-				results[i] = result{err: err}
+				results[i] = result{err: err, latency: time.Since(start)}
 				return
 			}
 			results[i] = result{vals: lo.Map(searchRes.Channel.Items, func(item newznab.Item, index int) FeedItem {
 				return FeedItemFromNewznab(item, b.name, FeedItemSourceSearch)
-			})}
+			}), latency: time.Since(start)}
 		}()
 	}
 	wg.Wait()
 	remoteMatches := make([]FeedItem, 0, 10)
+	relevance := make(map[string]float64)
 	for i, res := range results {
-		b := p.backends[i]
+		b := set.backends[i]
 		if res.skipped {
+			entry.Backends = append(entry.Backends, SearchLogBackend{IndexerName: b.name, Outcome: SearchOutcomeSkip})
+			metrics.SearchCache.WithLabelValues(b.name, "skip").Inc()
+			span.AddEvent("backend skipped", trace.WithAttributes(attribute.String("newznab.backend", b.name)))
 			cacheEntry := searchCache[b.name]
-			fmt.Printf("%s: skipped because search result status was %s, err message %s",
-				p.backends[i].name, cacheEntry.SearchResultStatus, cacheEntry.ErrorMessage)
+			slog.DebugContext(ctx, "backend skipped by search cache", "backend", b.name, "query", params.Query,
+				"status", cacheEntry.SearchResultStatus, "cachedError", cacheEntry.ErrorMessage)
 			continue
 		}
 
 		if res.err != nil {
-			fmt.Printf("%s: Failed to get results because: %s", b.name, res.err)
+			entry.Backends = append(entry.Backends, SearchLogBackend{
+				IndexerName: b.name,
+				Outcome:     string(SearchResultStatusError),
+				LatencyMS:   res.latency.Milliseconds(),
+			})
+			metrics.SearchCache.WithLabelValues(b.name, string(SearchResultStatusError)).Inc()
 			err = p.s.UpsertSearchCacheEntry(ctx, SearchCacheEntry{
 				IndexerName:        b.name,
 				Query:              params.Query,
@@ -230,6 +434,15 @@ func (p *Proxy) Search(ctx context.Context, params newznab.SearchParams) (*newzn
 		if len(res.vals) == 0 {
 			status = SearchResultStatusMiss
 		}
+		entry.Backends = append(entry.Backends, SearchLogBackend{
+			IndexerName: b.name,
+			Outcome:     string(status),
+			Results:     len(res.vals),
+			LatencyMS:   res.latency.Milliseconds(),
+		})
+		entry.RemoteResults += len(res.vals)
+		metrics.SearchCache.WithLabelValues(b.name, string(status)).Inc()
+		metrics.BackendSearchResults.WithLabelValues(b.name).Add(float64(len(res.vals)))
 		err = p.s.UpsertSearchCacheEntry(ctx, SearchCacheEntry{
 			IndexerName:        b.name,
 			Query:              params.Query,
@@ -241,16 +454,44 @@ func (p *Proxy) Search(ctx context.Context, params newznab.SearchParams) (*newzn
 		if err != nil {
 			return nil, err
 		}
-		for _, fi := range res.vals {
-
-			err = p.s.InsertFeedItem(ctx, fi)
-			if err != nil {
-				return nil, err
+		positionalRelevance(res.vals, relevance)
+		// As in RSS ingest, items rejected by rules that aren't scoped to an
+		// API key aren't stored. Items may already be stored yet have been
+		// hidden from the local search, e.g. by a key-scoped rule.
+		existingIDs, err := p.s.GetFeedItemUUIDs(ctx, lo.Map(res.vals, func(item FeedItem, index int) string {
+			return item.UUID
+		}))
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range set.filters.apply(res.vals, "") {
+			if _, ok := existingIDs[fi.UUID]; !ok {
+				err = p.s.InsertFeedItem(ctx, fi)
+				if err != nil {
+					return nil, err
+				}
 			}
 			remoteMatches = append(remoteMatches, fi)
 		}
 	}
-	return feedItemsToRssFeed(remoteMatches, p.c.Web.ExternalHost, p.c.Web.Port, p.c.Web.TLS), nil
+	remoteMatches = set.filters.apply(remoteMatches, apiKey)
+	span.SetAttributes(attribute.Int("proxy.results", len(remoteMatches)))
+	err = set.order(remoteMatches, params, relevance, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return feedItemsToRssFeed(ctx, remoteMatches, p.links), nil
+}
+
+// order applies the sort requested in params if there is one, and otherwise
+// ranks items using the scoring profile for apiKey.
+func (s *backendSet) order(items []FeedItem, params newznab.SearchParams, relevance map[string]float64, apiKey string) error {
+
+	if params.Sort != "" {
+		return sortItems(items, params.Sort)
+	}
+	s.ranker.rank(items, relevance, apiKey)
+	return nil
 }
 
 func (p *Proxy) GetNZB(ctx context.Context, id string) (newznab.NZB, error) {
@@ -259,27 +500,12 @@ func (p *Proxy) GetNZB(ctx context.Context, id string) (newznab.NZB, error) {
 	nzbData, err := p.s.GetNZBDataByUUID(ctx, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ret, newznab.ServerError{
-				Code:        400,
-				Description: "no NZB found with id " + id,
-			}
+			return ret, noSuchItemError(id)
 		}
 		return ret, err
 	}
-	var source *backend
-	for _, b := range p.backends {
-		if b.name == nzbData.IndexerName {
-			source = &b
-			break
-		}
-	}
-	if source == nil {
-		return ret, newznab.ServerError{
-			Code:        400,
-			Description: "the indexer that provided this NZB is no longer configured: " + nzbData.IndexerName,
-		}
-	}
-	data, err := source.client.GetNZB(ctx, nzbData.URL)
+	data, err := p.fetchNZB(ctx, nzbData)
+	p.recordGrab(ctx, id, nzbData, len(data), err)
 	if err != nil {
 		return ret, err
 	}
@@ -289,3 +515,115 @@ func (p *Proxy) GetNZB(ctx context.Context, id string) (newznab.NZB, error) {
 	}
 	return ret, nil
 }
+
+func (p *Proxy) fetchNZB(ctx context.Context, nzbData NZBData) ([]byte, error) {
+
+	source, err := p.backendByName(nzbData.IndexerName)
+	if err != nil {
+		return nil, err
+	}
+	return source.client.GetNZB(ctx, nzbData.URL)
+}
+
+// recordGrab adds a grab to the history, logging rather than returning any
+// error so that the grab itself isn't failed.
+func (p *Proxy) recordGrab(ctx context.Context, id string, nzbData NZBData, size int, grabErr error) {
+
+	metrics.Grabs.WithLabelValues(nzbData.IndexerName, metrics.Outcome(grabErr)).Inc()
+	metrics.GrabBytes.WithLabelValues(nzbData.IndexerName).Add(float64(size))
+
+	g := Grab{
+		FeedItemID:  id,
+		IndexerName: nzbData.IndexerName,
+		Title:       nzbData.Title,
+		APIKey:      newznab.APIKeyFromContext(ctx),
+		GrabbedAt:   time.Now(),
+		Size:        size,
+	}
+	if grabErr != nil {
+		g.Error = grabErr.Error()
+	}
+	err := p.s.InsertGrab(context.WithoutCancel(ctx), g)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording grab", "backend", nzbData.IndexerName, "id", id, "err", err)
+	}
+}
+
+func (p *Proxy) Details(ctx context.Context, id string) (*newznab.RssFeed, error) {
+
+	return p.details(ctx, id, p.links)
+}
+
+func (p *Proxy) details(ctx context.Context, id string, lr LinkRewriter) (*newznab.RssFeed, error) {
+
+	fi, source, err := p.loadFeedItem(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := source.client.Details(ctx, fi.RemoteID())
+	if err != nil {
+		slog.WarnContext(ctx, "error getting details, using stored item", "backend", source.name, "id", id, "err", err)
+	} else if len(res.Channel.Items) > 0 {
+		remote := FeedItemFromNewznab(res.Channel.Items[0], source.name, fi.Source)
+		attrs := make(map[string]string, len(fi.Attrs)+len(remote.Attrs))
+		maps.Copy(attrs, fi.Attrs)
+		maps.Copy(attrs, remote.Attrs)
+		remote.UUID = fi.UUID
+		remote.Attrs = attrs
+		fi = remote
+	}
+	return feedItemsToRssFeed(ctx, []FeedItem{fi}, lr), nil
+}
+
+func (p *Proxy) Caps(ctx context.Context) (*newznab.Caps, error) {
+
+	return newCaps("newznab-proxy", newznab.StandardCategories), nil
+}
+
+func (p *Proxy) GetNFO(ctx context.Context, id string) (newznab.NFO, error) {
+
+	var ret newznab.NFO
+	fi, source, err := p.loadFeedItem(ctx, id)
+	if err != nil {
+		return ret, err
+	}
+	data, err := source.client.GetNFO(ctx, fi.RemoteID())
+	if err != nil {
+		return ret, err
+	}
+	ret = newznab.NFO{
+		Title: fi.Title,
+		Data:  data,
+	}
+	return ret, nil
+}
+
+// loadFeedItem loads the stored item with id together with the backend that
+// provided it.
+func (p *Proxy) loadFeedItem(ctx context.Context, id string) (FeedItem, *backend, error) {
+
+	fi, err := p.s.GetFeedItemByUUID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fi, nil, noSuchItemError(id)
+		}
+		return fi, nil, err
+	}
+	source, err := p.backendByName(fi.IndexerName)
+	if err != nil {
+		return fi, nil, err
+	}
+	return fi, source, nil
+}
+
+func (p *Proxy) backendByName(name string) (*backend, error) {
+
+	return p.current().backendByName(name)
+}
+
+func noSuchItemError(id string) error {
+	return newznab.ServerError{
+		Code:        400,
+		Description: "no item found with id " + id,
+	}
+}
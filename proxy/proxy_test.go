@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewrittenLinks_apiKey(t *testing.T) {
+
+	var backend *httptest.Server
+	backend = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nzb/1" {
+			rw.Write([]byte("<nzb/>"))
+			return
+		}
+		items := []newznab.Item{{
+			Title:     "Some.Show.S01E01",
+			GUID:      newznab.RssGuid{Value: "1"},
+			Enclosure: newznab.RssEnclosure{URL: backend.URL + "/nzb/1"},
+		}}
+		body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, len(items), items))
+		rw.Write(body)
+	}))
+	defer backend.Close()
+
+	// With no link secret configured, links carry the key they were found
+	// with instead of a signature.
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Backends[0].BaseURL = backend.URL
+	c.Backends[0].RSS = nil
+	p, err := NewProxy(context.Background(), c)
+	require.NoError(t, err)
+	srv := httptest.NewServer(newznab.NewServer(p, newznab.WithAPIKeyValidation(func() ([]string, error) {
+		return []string{"key"}, nil
+	})).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api?t=search&q=some+show&apikey=key")
+	require.NoError(t, err)
+	var feed newznab.RssFeed
+	require.NoError(t, xmlutil.NewDecoder(resp.Body).Decode(&feed))
+	resp.Body.Close()
+	require.Len(t, feed.Channel.Items, 1)
+	link, err := url.Parse(feed.Channel.Items[0].Enclosure.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "key", link.Query().Get("apikey"))
+
+	resp, err = http.Get(srv.URL + link.RequestURI())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "<nzb/>", string(body))
+}
+
+func TestFeedItem_jsonLeavesOutUpstreamLinks(t *testing.T) {
+
+	body, err := json.Marshal(FeedItem{
+		UUID:    "1",
+		Link:    "http://indexer.invalid/details/1?apikey=secret",
+		NZBLink: "http://indexer.invalid/getnzb/1?apikey=secret",
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "secret")
+}
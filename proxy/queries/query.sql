@@ -11,7 +11,7 @@ INSERT INTO feed_item_meta (feed_item_id, name, value) VALUES (?, ?, ?);
 
 -- name: SearchForFeedItem :many
 SELECT feed_items.* FROM feed_items
-JOIN feed_items_fts5 f on feed_items.id = f.id
+JOIN feed_items_fts5 f on feed_items.id = f.rowid
 WHERE f.title MATCH ?
 ORDER BY f.rank;
 
@@ -41,3 +41,212 @@ ON CONFLICT(indexer_name, query) DO UPDATE SET last_tried    = excluded.last_tri
 
 -- name: GetNZBDataByUUID :one
 SELECT title, indexer_name, nzb_url FROM feed_items WHERE uuid = ? LIMIT 1;
+
+-- name: GetFeedItemByUUID :one
+SELECT * FROM feed_items WHERE uuid = ? LIMIT 1;
+
+-- name: ListRecentFeedItems :many
+SELECT * FROM feed_items
+WHERE (CAST(sqlc.arg(any_indexer) AS BOOLEAN) OR indexer_name IN (sqlc.slice(indexers)))
+  AND (CAST(sqlc.arg(any_category) AS BOOLEAN) OR id IN (
+      SELECT feed_item_id FROM feed_item_meta
+      WHERE name = 'category'
+        AND (value IN (sqlc.slice(categories)) OR (CAST(value AS INTEGER) / 1000) * 1000 IN (sqlc.slice(parent_categories)))))
+ORDER BY unixepoch(pub_date) DESC, id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetFeedPollState :one
+SELECT * FROM feed_poll_state WHERE indexer_name = ? AND feed_name = ?;
+
+-- name: UpsertFeedPollState :exec
+INSERT INTO feed_poll_state (indexer_name, feed_name, last_guid, last_pub_date, offset_unsupported, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(indexer_name, feed_name) DO UPDATE SET last_guid          = excluded.last_guid,
+                                                   last_pub_date      = excluded.last_pub_date,
+                                                   offset_unsupported = excluded.offset_unsupported,
+                                                   updated_at         = excluded.updated_at;
+
+-- name: InsertFeedPollRun :exec
+INSERT INTO feed_poll_runs (indexer_name, feed_name, started_at, finished_at, items_seen, items_new, http_status, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListFeedPollRuns :many
+SELECT * FROM feed_poll_runs
+WHERE indexer_name = ? AND feed_name = ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: GetLastSuccessfulFeedPollRun :one
+SELECT * FROM feed_poll_runs
+WHERE indexer_name = ? AND feed_name = ? AND error IS NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: CountFeedPollRunsAfter :one
+SELECT count(*) FROM feed_poll_runs
+WHERE indexer_name = ? AND feed_name = ? AND id > ?;
+
+-- name: InsertAPIKey :exec
+INSERT INTO api_keys (key, name, created_at) VALUES (?, ?, ?);
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked_at = ?
+WHERE (key = ? OR name = ?) AND revoked_at IS NULL;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys ORDER BY created_at, name;
+
+-- name: ListActiveAPIKeys :many
+SELECT key FROM api_keys WHERE revoked_at IS NULL;
+
+-- name: GetDBStats :one
+SELECT (SELECT count(*) FROM feed_items)     AS feed_items,
+       (SELECT count(*) FROM feed_item_meta) AS feed_item_meta,
+       (SELECT count(*) FROM search_cache)   AS search_cache_entries,
+       (SELECT count(*) FROM feed_poll_runs) AS feed_poll_runs,
+       (SELECT count(*) FROM api_keys)       AS api_keys;
+
+-- name: CountFeedItemsByIndexer :many
+SELECT indexer_name, source, count(*) AS items FROM feed_items
+GROUP BY indexer_name, source
+ORDER BY indexer_name, source;
+
+-- name: DeleteSearchCacheEntries :execrows
+DELETE FROM search_cache
+WHERE (CAST(sqlc.arg(any_indexer) AS BOOLEAN) OR indexer_name = sqlc.arg(indexer_name))
+  AND last_tried < sqlc.arg(before);
+
+-- name: ListSearchCacheEntries :many
+SELECT * FROM search_cache
+WHERE (CAST(sqlc.arg(any_indexer) AS BOOLEAN) OR indexer_name = sqlc.arg(indexer_name))
+  AND (CAST(sqlc.arg(any_status) AS BOOLEAN) OR status = sqlc.arg(status))
+  AND query LIKE sqlc.arg(query_pattern)
+ORDER BY last_tried DESC, id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: CountSearchCacheOutcomes :many
+SELECT indexer_name, status, count(*) AS entries, max(last_tried) AS last_tried FROM search_cache
+WHERE last_tried >= ?
+GROUP BY indexer_name, status;
+
+-- name: GetLastSearchCacheError :one
+SELECT * FROM search_cache
+WHERE indexer_name = ? AND status = 'error'
+ORDER BY last_tried DESC
+LIMIT 1;
+
+-- name: InsertGrab :exec
+INSERT INTO grabs (feed_item_uuid, indexer_name, title, api_key, grabbed_at, size, error)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListGrabs :many
+SELECT g.*, k.name AS api_key_name
+FROM grabs g
+         LEFT JOIN api_keys k ON k.key = g.api_key
+WHERE (CAST(sqlc.arg(any_indexer) AS BOOLEAN) OR g.indexer_name = sqlc.arg(indexer_name))
+  AND (CAST(sqlc.arg(any_item) AS BOOLEAN) OR g.feed_item_uuid = sqlc.arg(feed_item_uuid))
+  AND (CAST(sqlc.arg(any_api_key) AS BOOLEAN) OR g.api_key = sqlc.arg(api_key) OR k.name = sqlc.arg(api_key))
+  AND (CAST(sqlc.arg(any_outcome) AS BOOLEAN) OR (g.error IS NULL) = CAST(sqlc.arg(succeeded) AS BOOLEAN))
+  AND g.title LIKE sqlc.arg(title_pattern)
+  AND g.grabbed_at >= sqlc.arg(since)
+ORDER BY g.id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: ListGrabsOfRelease :many
+SELECT g.*, k.name AS api_key_name
+FROM grabs g
+         LEFT JOIN api_keys k ON k.key = g.api_key
+WHERE g.feed_item_uuid = sqlc.arg(feed_item_uuid)
+   OR g.title = sqlc.arg(title) COLLATE NOCASE
+ORDER BY g.id DESC;
+
+-- name: GetGrabStats :many
+SELECT g.indexer_name,
+       count(*)                                                AS grabs,
+       CAST(coalesce(sum(g.error IS NOT NULL), 0) AS INTEGER) AS failed,
+       CAST(coalesce(sum(g.size), 0) AS INTEGER)              AS bytes,
+       CAST(max(g.grabbed_at) AS INTEGER)                     AS last_grabbed
+FROM grabs g
+         LEFT JOIN api_keys k ON k.key = g.api_key
+WHERE g.grabbed_at >= sqlc.arg(since)
+  AND (CAST(sqlc.arg(any_api_key) AS BOOLEAN) OR g.api_key = sqlc.arg(api_key) OR k.name = sqlc.arg(api_key))
+GROUP BY g.indexer_name
+ORDER BY g.indexer_name;
+
+-- name: CountGrabsSince :many
+SELECT indexer_name, count(*) AS grabs FROM grabs
+WHERE grabbed_at >= ? AND error IS NULL
+GROUP BY indexer_name;
+
+-- name: CountFeedPollRunsSince :many
+SELECT indexer_name, count(*) AS runs FROM feed_poll_runs
+WHERE started_at >= ?
+GROUP BY indexer_name;
+
+-- name: InsertSearchLog :one
+INSERT INTO search_log (searched_at, feed, query, params, api_key, local_results, remote_results, results, latency_ms, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: InsertSearchLogBackend :exec
+INSERT INTO search_log_backends (search_log_id, indexer_name, outcome, results, latency_ms)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: ListSearchLog :many
+SELECT l.*, k.name AS api_key_name
+FROM search_log l
+         LEFT JOIN api_keys k ON k.key = l.api_key
+WHERE l.searched_at >= sqlc.arg(since)
+  AND l.query LIKE sqlc.arg(query_pattern)
+ORDER BY l.id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: ListSearchLogBackends :many
+SELECT * FROM search_log_backends
+WHERE search_log_id IN (sqlc.slice(ids))
+ORDER BY search_log_id, indexer_name;
+
+-- name: GetTopSearchQueries :many
+SELECT lower(query)                                    AS query,
+       count(*)                                        AS searches,
+       CAST(coalesce(sum(results = 0), 0) AS INTEGER) AS empty_searches,
+       CAST(max(searched_at) AS INTEGER)              AS last_searched
+FROM search_log
+WHERE searched_at >= sqlc.arg(since) AND query != ''
+GROUP BY lower(query)
+HAVING CAST(sqlc.arg(any_results) AS BOOLEAN) OR max(results) = 0
+ORDER BY searches DESC, last_searched DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetSearchBackendStats :many
+SELECT b.indexer_name,
+       count(*)                                                 AS searches,
+       CAST(coalesce(sum(b.outcome = 'hit'), 0) AS INTEGER)     AS hits,
+       CAST(coalesce(sum(b.outcome = 'miss'), 0) AS INTEGER)    AS misses,
+       CAST(coalesce(sum(b.outcome = 'error'), 0) AS INTEGER)   AS errors,
+       CAST(coalesce(sum(b.outcome = 'skip'), 0) AS INTEGER)    AS skips,
+       CAST(coalesce(sum(b.results), 0) AS INTEGER)             AS results,
+       CAST(coalesce(avg(CASE WHEN b.outcome != 'skip' THEN b.latency_ms END), 0) AS REAL) AS avg_latency_ms
+FROM search_log_backends b
+         JOIN search_log l ON l.id = b.search_log_id
+WHERE l.searched_at >= sqlc.arg(since)
+GROUP BY b.indexer_name
+ORDER BY b.indexer_name;
+
+-- name: ListFeedItemSources :many
+SELECT DISTINCT indexer_name, source FROM feed_items;
+
+-- name: ListExpiredFeedItemIDs :many
+SELECT id FROM feed_items
+WHERE indexer_name = sqlc.arg(indexer_name)
+  AND source = sqlc.arg(source)
+  AND created_at < datetime(CAST(sqlc.arg(before) AS INTEGER), 'unixepoch')
+  AND NOT (CAST(sqlc.arg(keep_grabbed) AS BOOLEAN) AND uuid IN (SELECT feed_item_uuid FROM grabs WHERE error IS NULL))
+ORDER BY created_at
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteFeedItemMetas :exec
+DELETE FROM feed_item_meta WHERE feed_item_id IN (sqlc.slice(ids));
+
+-- name: DeleteFeedItems :execrows
+DELETE FROM feed_items WHERE id IN (sqlc.slice(ids));
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/release"
+)
+
+var defaultResolutionScores = map[string]float64{
+	"2160p": 1,
+	"1080p": 0.8,
+	"720p":  0.6,
+	"576p":  0.3,
+	"480p":  0.2,
+}
+
+var defaultSourceScores = map[string]float64{
+	"remux":    1,
+	"bluray":   0.9,
+	"webdl":    0.8,
+	"web":      0.75,
+	"webrip":   0.7,
+	"hdtv":     0.5,
+	"dvdrip":   0.4,
+	"dvd":      0.4,
+	"hdrip":    0.3,
+	"sdtv":     0.2,
+	"telesync": 0.05,
+	"cam":      0,
+}
+
+const defaultAgeHalfLife = time.Hour * 24 * 7
+
+type ranker struct {
+	profiles       map[string]RankingProfile
+	defaultProfile string
+	apiKeyProfiles map[string]string
+	priorities     map[string]int
+	now            func() time.Time
+}
+
+func newRanker(c *Config) (*ranker, error) {
+
+	ret := &ranker{
+		profiles:       make(map[string]RankingProfile, len(c.Ranking.Profiles)),
+		defaultProfile: c.Ranking.DefaultProfile,
+		apiKeyProfiles: c.Ranking.APIKeyProfiles,
+		priorities:     make(map[string]int, len(c.Backends)),
+		now:            time.Now,
+	}
+	for _, prof := range c.Ranking.Profiles {
+		if prof.Resolutions == nil {
+			prof.Resolutions = defaultResolutionScores
+		}
+		if prof.Sources == nil {
+			prof.Sources = defaultSourceScores
+		}
+		prof.AgeHalfLife = cmp.Or(prof.AgeHalfLife, defaultAgeHalfLife)
+		ret.profiles[prof.Name] = prof
+	}
+	if ret.defaultProfile == "" && len(c.Ranking.Profiles) == 1 {
+		ret.defaultProfile = c.Ranking.Profiles[0].Name
+	}
+	if _, ok := ret.profiles[ret.defaultProfile]; ret.defaultProfile != "" && !ok {
+		return nil, fmt.Errorf("ranking: default profile %s is not defined", ret.defaultProfile)
+	}
+	for key, name := range ret.apiKeyProfiles {
+		if _, ok := ret.profiles[name]; !ok {
+			return nil, fmt.Errorf("ranking: profile %s for API key %s is not defined", name, key)
+		}
+	}
+	for _, b := range c.Backends {
+		ret.priorities[b.Name] = b.Priority
+	}
+	return ret, nil
+}
+
+func (r *ranker) profileFor(apiKey string) (RankingProfile, bool) {
+
+	name, ok := r.apiKeyProfiles[apiKey]
+	if !ok {
+		name = r.defaultProfile
+	}
+	prof, ok := r.profiles[name]
+	return prof, ok
+}
+
+// rank sorts items by descending score under the profile for apiKey, leaving
+// them untouched if there is no such profile. relevance holds the relevance of
+// each item by UUID as returned by positionalRelevance.
+func (r *ranker) rank(items []FeedItem, relevance map[string]float64, apiKey string) {
+
+	prof, ok := r.profileFor(apiKey)
+	if !ok || len(items) == 0 {
+		return
+	}
+	var maxSize int64
+	var maxPopularity float64
+	minPriority, maxPriority := math.MaxInt, math.MinInt
+	for _, fi := range items {
+		maxSize = max(maxSize, fi.Size)
+		maxPopularity = max(maxPopularity, popularity(fi))
+		minPriority = min(minPriority, r.priorities[fi.IndexerName])
+		maxPriority = max(maxPriority, r.priorities[fi.IndexerName])
+	}
+	maxResolution := maxValue(prof.Resolutions)
+	maxSource := maxValue(prof.Sources)
+	now := r.now()
+
+	scores := make(map[string]float64, len(items))
+	for _, fi := range items {
+		w := prof.Weights
+		// Quality is parsed from the title rather than read from attrs, as
+		// indexers format their own resolution attrs inconsistently.
+		info := release.Parse(fi.Title)
+		var score float64
+		score += w.Quality * (ratio(prof.Resolutions[info.Resolution], maxResolution) +
+			ratio(prof.Sources[info.Source], maxSource)) / 2
+		score += w.Size * ratio(float64(fi.Size), float64(maxSize))
+		age := now.Sub(fi.PubDate)
+		score += w.Age * math.Pow(0.5, max(age, 0).Hours()/prof.AgeHalfLife.Hours())
+		score += w.Priority * ratio(float64(r.priorities[fi.IndexerName]-minPriority), float64(maxPriority-minPriority))
+		score += w.Popularity * ratio(popularity(fi), maxPopularity)
+		score += w.Relevance * relevance[fi.UUID]
+		scores[fi.UUID] = score
+	}
+	slices.SortStableFunc(items, func(a, b FeedItem) int {
+		return cmp.Compare(scores[b.UUID], scores[a.UUID])
+	})
+}
+
+// positionalRelevance scores items between 1 for the first and 0 for the last,
+// on the basis that they are in the order the source thought most relevant.
+func positionalRelevance(items []FeedItem, into map[string]float64) {
+
+	for i, fi := range items {
+		into[fi.UUID] = 1 - ratio(float64(i), float64(len(items)))
+	}
+}
+
+func popularity(fi FeedItem) float64 {
+
+	grabs, _ := strconv.Atoi(fi.Attrs["grabs"])
+	comments, _ := strconv.Atoi(fi.Attrs["comments"])
+	return math.Log1p(float64(max(grabs, 0) + max(comments, 0)))
+}
+
+func ratio(v, of float64) float64 {
+
+	if of <= 0 {
+		return 0
+	}
+	return v / of
+}
+
+func maxValue(m map[string]float64) float64 {
+
+	var ret float64
+	for _, v := range m {
+		ret = max(ret, v)
+	}
+	return ret
+}
+
+var sortKeys = map[string]func(a, b FeedItem) int{
+	"name": func(a, b FeedItem) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	},
+	"size": func(a, b FeedItem) int {
+		return cmp.Compare(a.Size, b.Size)
+	},
+	"posted": func(a, b FeedItem) int {
+		return a.PubDate.Compare(b.PubDate)
+	},
+	"cat": func(a, b FeedItem) int {
+		return strings.Compare(a.Attrs["category"], b.Attrs["category"])
+	},
+	"files": func(a, b FeedItem) int {
+		return cmp.Compare(intAttr(a, "files"), intAttr(b, "files"))
+	},
+	"stats": func(a, b FeedItem) int {
+		return cmp.Compare(intAttr(a, "grabs"), intAttr(b, "grabs"))
+	},
+}
+
+// checkSort returns an error if sort is set but isn't one the proxy supports.
+func checkSort(sort string) error {
+
+	if sort == "" {
+		return nil
+	}
+	field, _ := newznab.SortOrder(sort)
+	if _, ok := sortKeys[field]; !ok {
+		return newznab.ServerError{
+			Code:        400,
+			Description: "unsupported sort " + sort,
+		}
+	}
+	return nil
+}
+
+// sortItems sorts items by the newznab sort parameter sort.
+func sortItems(items []FeedItem, sort string) error {
+
+	if err := checkSort(sort); err != nil {
+		return err
+	}
+	field, desc := newznab.SortOrder(sort)
+	compare := sortKeys[field]
+	slices.SortStableFunc(items, func(a, b FeedItem) int {
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+	return nil
+}
+
+func intAttr(fi FeedItem, name string) int {
+
+	v, _ := strconv.Atoi(fi.Attrs[name])
+	return v
+}
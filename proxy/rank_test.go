@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRanker_Rank(t *testing.T) {
+
+	r, err := newRanker(&Config{
+		Backends: []BackendConfig{{Name: "a", Priority: 1}, {Name: "b", Priority: 2}},
+		Ranking: RankingConfig{
+			Profiles: []RankingProfile{
+				{Name: "quality", Weights: RankingWeights{Quality: 1, Priority: 0.1}},
+				{Name: "priority", Weights: RankingWeights{Priority: 1}},
+			},
+			DefaultProfile: "quality",
+			APIKeyProfiles: map[string]string{"k": "priority"},
+		},
+	})
+	require.Nil(t, err)
+
+	items := func() []FeedItem {
+		return []FeedItem{
+			{UUID: "1", IndexerName: "b", Title: "Movie.2019.720p.HDTV.x264-A"},
+			{UUID: "2", IndexerName: "a", Title: "Movie.2019.2160p.BluRay.x265-B"},
+			{UUID: "3", IndexerName: "a", Title: "Movie.2019.720p.HDTV.x264-C"},
+		}
+	}
+	uuids := func(fis []FeedItem) []string {
+		var ret []string
+		for _, fi := range fis {
+			ret = append(ret, fi.UUID)
+		}
+		return ret
+	}
+
+	ranked := items()
+	r.rank(ranked, nil, "")
+	assert.Equal(t, []string{"2", "1", "3"}, uuids(ranked))
+
+	ranked = items()
+	r.rank(ranked, nil, "k")
+	assert.Equal(t, []string{"1", "2", "3"}, uuids(ranked))
+}
+
+func TestSortItems(t *testing.T) {
+
+	now := time.Now()
+	items := []FeedItem{
+		{UUID: "1", Size: 2, PubDate: now},
+		{UUID: "2", Size: 3, PubDate: now.Add(-time.Hour)},
+		{UUID: "3", Size: 1, PubDate: now.Add(time.Hour)},
+	}
+	require.Nil(t, sortItems(items, "size_asc"))
+	assert.Equal(t, []string{"3", "1", "2"}, []string{items[0].UUID, items[1].UUID, items[2].UUID})
+	require.Nil(t, sortItems(items, "posted_desc"))
+	assert.Equal(t, []string{"3", "1", "2"}, []string{items[0].UUID, items[1].UUID, items[2].UUID})
+	assert.NotNil(t, sortItems(items, "bogus_asc"))
+}
+
+func TestProxy_sortsEveryPath(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProxy(ctx, reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite")))
+	require.NoError(t, err)
+	now := time.Now()
+	for _, fi := range []FeedItem{
+		{UUID: "1", IndexerName: "a", Title: "Some.Show.S01E01", Size: 2, PubDate: now},
+		{UUID: "2", IndexerName: "a", Title: "Some.Show.S01E02", Size: 3, PubDate: now.Add(-time.Hour)},
+		{UUID: "3", IndexerName: "a", Title: "Some.Show.S01E03", Size: 1, PubDate: now.Add(-2 * time.Hour)},
+	} {
+		require.NoError(t, p.s.InsertFeedItem(ctx, fi))
+	}
+	titles := func(feed *newznab.RssFeed) []string {
+		var ret []string
+		for _, item := range feed.Channel.Items {
+			ret = append(ret, item.Title)
+		}
+		return ret
+	}
+	want := []string{"Some.Show.S01E03", "Some.Show.S01E01", "Some.Show.S01E02"}
+
+	feed, err := p.RSS(ctx, newznab.RSSParams{Sort: "size_asc"})
+	require.NoError(t, err)
+	assert.Equal(t, want, titles(feed))
+	feed, err = p.Search(ctx, newznab.SearchParams{Sort: "size_asc"})
+	require.NoError(t, err)
+	assert.Equal(t, want, titles(feed))
+	feed, err = p.Search(ctx, newznab.SearchParams{Query: "some show", Sort: "size_asc"})
+	require.NoError(t, err)
+	assert.Equal(t, want, titles(feed))
+
+	// An unsupported sort is refused before the backends are asked.
+	_, err = p.Search(ctx, newznab.SearchParams{Query: "other show", Sort: "bogus"})
+	assert.Equal(t, newznab.ServerError{Code: 400, Description: "unsupported sort bogus"}, err)
+	entries, err := p.SearchLog(ctx, SearchLogQuery{Query: "other"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Reload applies the backends, filters, ranking profiles and RSS feeds in c.
+// If c is invalid an error is returned and the running config is kept.
+// Requests in flight finish with the config they started with, and only the
+// pollers of feeds that were added, removed or changed are restarted.
+// Changes to other settings are logged and take effect on restart.
+func (p *Proxy) Reload(ctx context.Context, c *Config) error {
+
+	stopped, err := p.reload(ctx, c)
+	// The stopped pollers are waited for without holding p.pollersMu, as a
+	// poll can take a while to notice it has been cancelled.
+	for _, ch := range stopped {
+		<-ch
+	}
+	return err
+}
+
+// reload applies c, returning the channels of the pollers it stopped.
+func (p *Proxy) reload(ctx context.Context, c *Config) ([]<-chan struct{}, error) {
+
+	p.pollersMu.Lock()
+	defer p.pollersMu.Unlock()
+	prev := p.current()
+	next, err := newBackendSet(c, prev)
+	if err != nil {
+		return nil, err
+	}
+	for _, vf := range p.virtualFeeds {
+		for _, name := range vf.cfg.Backends {
+			if _, err := next.backendByName(name); err != nil {
+				return nil, fmt.Errorf("virtual feed %s: backend %s is not configured", vf.Name(), name)
+			}
+		}
+	}
+	warnRestartRequired(prev.c, c)
+
+	p.set.Store(next)
+	if p.pollerCtx == nil || p.pollersStopped {
+		return nil, nil
+	}
+	var stopped []<-chan struct{}
+	wanted := make(map[string]poller)
+	for _, b := range next.backends {
+		if b.rssCfg == nil {
+			continue
+		}
+		for _, feed := range b.rssCfg.Feeds {
+			wanted[feedKey(b.name, feed.Name)] = poller{backend: b, feed: feed}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(p.pollers)) {
+		running := p.pollers[key]
+		want, ok := wanted[key]
+		if ok && running.backend.client == want.backend.client &&
+			running.backend.rssCfg.RSSPath == want.backend.rssCfg.RSSPath &&
+			maps.Equal(running.backend.rssCfg.RSSQueryParams, want.backend.rssCfg.RSSQueryParams) &&
+			reflect.DeepEqual(running.feed, want.feed) {
+			delete(wanted, key)
+			continue
+		}
+		slog.InfoContext(ctx, "config reload: stopping poller", "feed", key)
+		stopped = append(stopped, p.stopPoller(key))
+	}
+	for _, key := range slices.Sorted(maps.Keys(wanted)) {
+		want := wanted[key]
+		slog.InfoContext(ctx, "config reload: starting poller", "feed", key)
+		p.startPoller(want.backend, want.feed, next.schedulers[key])
+	}
+	return stopped, nil
+}
+
+func warnRestartRequired(prev, next *Config) {
+
+	if !reflect.DeepEqual(prev.Web, next.Web) {
+		slog.Warn("config reload: web settings changed, restart to apply")
+	}
+	if !reflect.DeepEqual(prev.Storage, next.Storage) {
+		slog.Warn("config reload: storage settings changed, restart to apply")
+	}
+	if !reflect.DeepEqual(prev.Admin, next.Admin) {
+		slog.Warn("config reload: admin settings changed, restart to apply")
+	}
+	if !reflect.DeepEqual(prev.VirtualFeeds, next.VirtualFeeds) {
+		slog.Warn("config reload: virtual feeds changed, restart to apply")
+	}
+	if !reflect.DeepEqual(prev.Tracing, next.Tracing) {
+		slog.Warn("config reload: tracing settings changed, restart to apply")
+	}
+	// Only the log level is applied on reload.
+	if prev.Log.Format != next.Log.Format {
+		slog.Warn("config reload: log format changed, restart to apply")
+	}
+}
+
+// reloadDebounce is how long to wait for writes to the config file to settle
+// before reloading it.
+const reloadDebounce = 500 * time.Millisecond
+
+// WatchConfigFile calls onChange when the file at path is written, until ctx
+// is done. The directory is watched rather than the file, so that editors
+// that replace the file and Kubernetes ConfigMap updates are seen.
+func WatchConfigFile(ctx context.Context, path string, onChange func()) error {
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	err = w.Add(filepath.Dir(path))
+	if err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// ConfigMap updates swap a ..data symlink rather than
+				// touching the file itself.
+				if filepath.Clean(ev.Name) == path || filepath.Base(ev.Name) == "..data" {
+					debounce = time.After(reloadDebounce)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("error watching config file", "err", err)
+			case <-debounce:
+				debounce = nil
+				onChange()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
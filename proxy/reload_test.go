@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reloadTestConfig(dbPath string, feeds ...string) *Config {
+
+	rss := &RSSConfig{RSSPath: "rss"}
+	for _, f := range feeds {
+		rss.Feeds = append(rss.Feeds, RSSFeed{Name: f, PollInterval: time.Hour})
+	}
+	return &Config{
+		Storage: StorageConfig{DBPath: dbPath},
+		Backends: []BackendConfig{
+			{Name: "a", BaseURL: "http://a.invalid", APIKey: "k", RSS: rss},
+		},
+	}
+}
+
+func TestProxy_Reload(t *testing.T) {
+
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite")
+	p, err := NewProxy(ctx, reloadTestConfig(dbPath, "tv", "movies"))
+	require.NoError(t, err)
+	p.StartRSSPolls(ctx)
+	defer p.StopRSSPolls()
+	tv := p.pollers["a/tv"]
+	client := p.current().backends[0].client
+
+	c := reloadTestConfig(dbPath, "tv", "books")
+	c.Backends = append(c.Backends, BackendConfig{Name: "b", BaseURL: "http://b.invalid"})
+	require.NoError(t, p.Reload(ctx, c))
+	assert.ElementsMatch(t, []string{"a/tv", "a/books"}, slices.Collect(maps.Keys(p.pollers)))
+	assert.Same(t, tv, p.pollers["a/tv"])
+	assert.Same(t, client, p.current().backends[0].client)
+	_, err = p.backendByName("b")
+	assert.NoError(t, err)
+
+	// Changing the API key replaces the client and restarts its pollers.
+	c = reloadTestConfig(dbPath, "tv", "books")
+	c.Backends[0].APIKey = "other"
+	require.NoError(t, p.Reload(ctx, c))
+	assert.NotSame(t, tv, p.pollers["a/tv"])
+	assert.NotSame(t, client, p.current().backends[0].client)
+	_, err = p.backendByName("b")
+	assert.Error(t, err)
+}
+
+func TestProxy_ReloadAfterStop(t *testing.T) {
+
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite")
+	p, err := NewProxy(ctx, reloadTestConfig(dbPath, "tv"))
+	require.NoError(t, err)
+	p.StartRSSPolls(ctx)
+	require.NoError(t, p.StopRSSPolls())
+	require.NoError(t, p.StopRSSPolls())
+
+	require.NoError(t, p.Reload(ctx, reloadTestConfig(dbPath, "tv", "books")))
+	assert.NotContains(t, p.pollers, "a/books")
+}
+
+func TestProxy_ReloadKeepsConfigOnError(t *testing.T) {
+
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite")
+	p, err := NewProxy(ctx, reloadTestConfig(dbPath))
+	require.NoError(t, err)
+
+	c := reloadTestConfig(dbPath)
+	c.Backends = append(c.Backends, c.Backends[0])
+	assert.Error(t, p.Reload(ctx, c))
+	assert.Len(t, p.current().backends, 1)
+}
+
+func TestProxy_ReloadCancelsPollInProgress(t *testing.T) {
+
+	ctx := context.Background()
+	// The first poll hangs until it is cancelled.
+	polling := make(chan struct{})
+	var once sync.Once
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		first := false
+		once.Do(func() {
+			first = true
+			close(polling)
+		})
+		if first {
+			<-r.Context().Done()
+			return
+		}
+		body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, 0, nil))
+		rw.Write(body)
+	}))
+	defer backend.Close()
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite")
+	config := func(apiKey string) *Config {
+		c := reloadTestConfig(dbPath, "tv")
+		c.Backends[0].BaseURL = backend.URL
+		c.Backends[0].APIKey = apiKey
+		// Poll straight away.
+		c.Backends[0].RSS.Feeds[0].Jitter = time.Nanosecond
+		return c
+	}
+	p, err := NewProxy(ctx, config("k"))
+	require.NoError(t, err)
+	p.StartRSSPolls(ctx)
+	defer p.StopRSSPolls()
+	<-polling
+
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- p.Reload(ctx, config("other"))
+	}()
+	select {
+	case err := <-reloaded:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload waited for the poll in progress")
+	}
+}
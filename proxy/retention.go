@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/henges/newznab-proxy/metrics"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultPruneInterval = 24 * time.Hour
+	// initialPruneDelay keeps the first prune out of the way of startup.
+	initialPruneDelay = time.Minute
+	pruneBatchSize    = 1000
+)
+
+// PruneResult records what a retention run deleted.
+type PruneResult struct {
+	// Items counts the expired items deleted, by backend and source.
+	Items              []IndexerItemCount `json:"items"`
+	SearchCacheEntries int                `json:"searchCacheEntries"`
+}
+
+func (c RetentionConfig) enabled() bool {
+
+	return c.MaxAge > 0 || slices.ContainsFunc(c.Rules, func(r RetentionRule) bool {
+		return r.MaxAge > 0
+	})
+}
+
+func (c RetentionConfig) interval() time.Duration {
+
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return defaultPruneInterval
+}
+
+// maxAge returns how long the items of indexer from source are kept, or 0 if
+// they are kept forever.
+func (c RetentionConfig) maxAge(indexer string, source FeedItemSource) time.Duration {
+
+	for _, r := range c.Rules {
+		if len(r.Backends) > 0 && !slices.Contains(r.Backends, indexer) {
+			continue
+		}
+		if r.Source != "" && FeedItemSource(r.Source) != source {
+			continue
+		}
+		return r.MaxAge
+	}
+	return c.MaxAge
+}
+
+// Prune deletes the stored items that have outlived the retention config,
+// along with their attrs, then compacts the database. The outcomes of
+// searches older than the items they found are forgotten too, so that those
+// searches go to the backends again.
+func (p *Proxy) Prune(ctx context.Context) (PruneResult, error) {
+
+	ctx, span := tracer.Start(ctx, "Proxy.Prune")
+	defer span.End()
+	ret, err := p.prune(ctx, p.current().c.Retention, time.Now())
+	recordError(span, err)
+	metrics.Prunes.WithLabelValues(metrics.Outcome(err)).Inc()
+	deleted := 0
+	for _, c := range ret.Items {
+		deleted += c.Items
+	}
+	span.SetAttributes(attribute.Int("proxy.items_deleted", deleted))
+	return ret, err
+}
+
+func (p *Proxy) prune(ctx context.Context, cfg RetentionConfig, now time.Time) (PruneResult, error) {
+
+	ret := PruneResult{Items: []IndexerItemCount{}}
+	sources, err := p.s.ListFeedItemSources(ctx)
+	if err != nil {
+		return ret, err
+	}
+	for _, src := range sources {
+		maxAge := cfg.maxAge(src.IndexerName, src.Source)
+		if maxAge <= 0 {
+			continue
+		}
+		q := ExpiredFeedItemsQuery{
+			IndexerName: src.IndexerName,
+			Source:      src.Source,
+			Before:      now.Add(-maxAge),
+			KeepGrabbed: cfg.KeepGrabbed,
+		}
+		for {
+			n, err := p.s.DeleteExpiredFeedItems(ctx, q, pruneBatchSize)
+			if err != nil {
+				return ret, err
+			}
+			src.Items += n
+			if n < pruneBatchSize {
+				break
+			}
+		}
+		if src.Items > 0 {
+			ret.Items = append(ret.Items, src)
+			metrics.PrunedItems.WithLabelValues(src.IndexerName, string(src.Source)).Add(float64(src.Items))
+		}
+		if src.Source == FeedItemSourceSearch {
+			n, err := p.s.DeleteSearchCacheEntries(ctx, src.IndexerName, q.Before)
+			if err != nil {
+				return ret, err
+			}
+			ret.SearchCacheEntries += n
+		}
+	}
+	return ret, p.s.Optimize(ctx)
+}
+
+// startPruner prunes expired items every retention interval until the
+// pollers are stopped. The config is reread before each run, so reloads
+// apply from the next one.
+func (p *Proxy) startPruner() {
+
+	ctx := p.pollerCtx
+	p.pollerWg.Add(1)
+	go func() {
+		defer p.pollerWg.Done()
+		delay := initialPruneDelay
+		for {
+			select {
+			case <-time.After(delay):
+				cfg := p.current().c.Retention
+				delay = cfg.interval()
+				if !cfg.enabled() {
+					continue
+				}
+				start := time.Now()
+				res, err := p.Prune(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "error pruning expired items", "err", err)
+					continue
+				}
+				slog.InfoContext(ctx, "pruned expired items", "items", res.Items,
+					"searchCacheEntries", res.SearchCacheEntries, "duration", time.Since(start))
+			case <-p.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
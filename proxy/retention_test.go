@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionConfig_maxAge(t *testing.T) {
+
+	c := RetentionConfig{
+		MaxAge: 30 * 24 * time.Hour,
+		Rules: []RetentionRule{
+			{Backends: []string{"a"}, Source: "search", MaxAge: 0},
+			{Backends: []string{"a", "b"}, MaxAge: time.Hour},
+			{Source: "search", MaxAge: 2 * time.Hour},
+		},
+	}
+	assert.Equal(t, time.Duration(0), c.maxAge("a", FeedItemSourceSearch))
+	assert.Equal(t, time.Hour, c.maxAge("a", FeedItemSourceRSS))
+	assert.Equal(t, time.Hour, c.maxAge("b", FeedItemSourceSearch))
+	assert.Equal(t, 2*time.Hour, c.maxAge("c", FeedItemSourceSearch))
+	assert.Equal(t, c.MaxAge, c.maxAge("c", FeedItemSourceRSS))
+	assert.True(t, c.enabled())
+	assert.False(t, RetentionConfig{Rules: []RetentionRule{{Source: "rss"}}}.enabled())
+}
+
+func TestProxy_prune(t *testing.T) {
+
+	ctx := context.Background()
+	p, err := NewProxy(ctx, reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite")))
+	require.NoError(t, err)
+	for _, fi := range []FeedItem{
+		{UUID: "old", IndexerName: "a", Title: "Some.Show.S01E01", Source: FeedItemSourceRSS, Attrs: map[string]string{"category": "5000"}},
+		{UUID: "grabbed", IndexerName: "a", Title: "Some.Show.S01E02", Source: FeedItemSourceRSS},
+		{UUID: "new", IndexerName: "a", Title: "Some.Show.S01E03", Source: FeedItemSourceRSS},
+		{UUID: "searched", IndexerName: "a", Title: "Some.Show.S01E04", Source: FeedItemSourceSearch},
+	} {
+		fi.PubDate = time.Now()
+		require.NoError(t, p.s.InsertFeedItem(ctx, fi))
+	}
+	_, err = p.s.db.ExecContext(ctx, "UPDATE feed_items SET created_at = datetime('now', '-2 days') WHERE uuid != 'new'")
+	require.NoError(t, err)
+	require.NoError(t, p.s.InsertGrab(ctx, Grab{FeedItemID: "grabbed", IndexerName: "a", Title: "Some.Show.S01E02", GrabbedAt: time.Now()}))
+	require.NoError(t, p.s.UpsertSearchCacheEntry(ctx, SearchCacheEntry{
+		IndexerName: "a", Query: "some show", FirstTried: time.Now().Add(-48 * time.Hour), LastTried: time.Now().Add(-48 * time.Hour),
+		SearchResultStatus: SearchResultStatusHit,
+	}))
+
+	res, err := p.prune(ctx, RetentionConfig{
+		MaxAge:      24 * time.Hour,
+		Rules:       []RetentionRule{{Source: "search", MaxAge: 72 * time.Hour}},
+		KeepGrabbed: true,
+	}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []IndexerItemCount{{IndexerName: "a", Source: FeedItemSourceRSS, Items: 1}}, res.Items)
+	assert.Equal(t, 0, res.SearchCacheEntries)
+
+	matches, err := p.s.SearchForFeedItem(ctx, "some show")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"grabbed", "new", "searched"}, uuids(matches))
+	stats, err := p.s.GetDBStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.FeedItems)
+	var metas int
+	require.NoError(t, p.s.db.QueryRowContext(ctx, "SELECT count(*) FROM feed_item_meta WHERE value = '5000'").Scan(&metas))
+	assert.Zero(t, metas)
+	index, err := p.CheckSearchIndex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, SearchIndexStatus{OK: true, Items: 3, Indexed: 3}, index)
+
+	// Searched items go once the search rule's age passes, along with the
+	// outcomes of the searches that found them.
+	res, err = p.prune(ctx, RetentionConfig{Rules: []RetentionRule{{Source: "search", MaxAge: time.Hour}}}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []IndexerItemCount{{IndexerName: "a", Source: FeedItemSourceSearch, Items: 1}}, res.Items)
+	assert.Equal(t, 1, res.SearchCacheEntries)
+}
+
+func uuids(items []FeedItem) []string {
+
+	ret := make([]string, len(items))
+	for i, fi := range items {
+		ret[i] = fi.UUID
+	}
+	return ret
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultMaxBackoff    = time.Hour
+	adaptiveGrowFactor   = 1.5
+	adaptiveShrinkFactor = 0.5
+)
+
+// feedScheduler decides how long to wait between polls of a feed.
+type feedScheduler struct {
+	interval   time.Duration
+	jitter     time.Duration
+	maxBackoff time.Duration
+	adaptive   *AdaptiveIntervalConfig
+	cronExpr   string
+	cron       cron.Schedule
+	windows    []pollWindow
+	loc        *time.Location
+	failures   int
+	randN      func(n int64) int64
+	now        func() time.Time
+}
+
+// pollWindow is a PollWindow with its times parsed to minutes past midnight.
+type pollWindow struct {
+	from, to int
+	interval time.Duration
+	days     map[time.Weekday]bool
+	desc     string
+}
+
+func newFeedScheduler(feed RSSFeed) (*feedScheduler, error) {
+
+	ret := &feedScheduler{
+		interval:   feed.PollInterval,
+		jitter:     feed.Jitter,
+		maxBackoff: feed.MaxBackoff,
+		adaptive:   feed.Adaptive,
+		cronExpr:   feed.Cron,
+		loc:        time.Local,
+		randN:      rand.Int64N,
+		now:        time.Now,
+	}
+	if feed.Timezone != "" {
+		loc, err := time.LoadLocation(feed.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("feed %s: %w", feed.Name, err)
+		}
+		ret.loc = loc
+	}
+	switch {
+	case feed.Cron != "" && len(feed.Windows) > 0:
+		return nil, fmt.Errorf("feed %s: cron and windows cannot both be set", feed.Name)
+	case feed.Cron != "":
+		sched, err := cron.ParseStandard(feed.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("feed %s: invalid cron expression: %w", feed.Name, err)
+		}
+		ret.cron = sched
+	case feed.PollInterval <= 0:
+		return nil, fmt.Errorf("feed %s: pollInterval must be positive", feed.Name)
+	}
+	for _, w := range feed.Windows {
+		pw, err := parsePollWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("feed %s: %w", feed.Name, err)
+		}
+		ret.windows = append(ret.windows, pw)
+	}
+	if ret.jitter == 0 {
+		ret.jitter = feed.PollInterval / 10
+	}
+	if ret.maxBackoff == 0 {
+		ret.maxBackoff = max(defaultMaxBackoff, feed.PollInterval)
+	}
+	if ret.adaptive != nil {
+		ret.interval = ret.clamp(ret.interval)
+	}
+	return ret, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parsePollWindow(w PollWindow) (pollWindow, error) {
+
+	desc := w.From + "-" + w.To
+	ret := pollWindow{interval: w.Interval, desc: desc}
+	var err error
+	if ret.from, err = parseTimeOfDay(w.From); err != nil {
+		return ret, fmt.Errorf("window %s: %w", desc, err)
+	}
+	if ret.to, err = parseTimeOfDay(w.To); err != nil {
+		return ret, fmt.Errorf("window %s: %w", desc, err)
+	}
+	if ret.from == ret.to {
+		return ret, fmt.Errorf("window %s is empty", desc)
+	}
+	if w.Interval <= 0 {
+		return ret, fmt.Errorf("window %s: interval must be positive", desc)
+	}
+	if len(w.Days) > 0 {
+		ret.days = make(map[time.Weekday]bool, len(w.Days))
+		for _, d := range w.Days {
+			wd, ok := weekdays[strings.ToLower(d[:min(len(d), 3)])]
+			if !ok {
+				return ret, fmt.Errorf("window %s: unknown day %s", desc, d)
+			}
+			ret.days[wd] = true
+		}
+		ret.desc += " " + strings.Join(w.Days, ",")
+	}
+	return ret, nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("times must be given as HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether the window is open at t.
+func (w pollWindow) contains(t time.Time) bool {
+
+	m := t.Hour()*60 + t.Minute()
+	start := t
+	if w.from < w.to {
+		if m < w.from || m >= w.to {
+			return false
+		}
+	} else {
+		if m < w.from && m >= w.to {
+			return false
+		}
+		if m < w.to {
+			// Past midnight, so the window opened the day before.
+			start = t.AddDate(0, 0, -1)
+		}
+	}
+	return w.days == nil || w.days[start.Weekday()]
+}
+
+// window returns the index of the window open at t, or -1 if there is none.
+// If windows overlap the first listed wins.
+func (s *feedScheduler) window(t time.Time) int {
+
+	t = t.In(s.loc)
+	for i, w := range s.windows {
+		if w.contains(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *feedScheduler) intervalAt(t time.Time) time.Duration {
+
+	if i := s.window(t); i >= 0 {
+		return s.windows[i].interval
+	}
+	return s.interval
+}
+
+// baseDelay is the delay from now until the next poll due on the schedule,
+// ignoring jitter and backoff.
+func (s *feedScheduler) baseDelay(now time.Time) time.Duration {
+
+	if s.cron != nil {
+		return s.cron.Next(now.In(s.loc)).Sub(now)
+	}
+	d := s.intervalAt(now)
+	if len(s.windows) == 0 {
+		return d
+	}
+	// Poll early if a window opens or closes before the interval is up, so a
+	// shorter interval takes effect promptly.
+	current := s.window(now)
+	for t := now.Truncate(time.Minute).Add(time.Minute); t.Before(now.Add(d)); t = t.Add(time.Minute) {
+		if s.window(t) != current {
+			return t.Sub(now)
+		}
+	}
+	return d
+}
+
+// initialDelay staggers the first poll of each feed. Cron schedules wait for
+// their first slot.
+func (s *feedScheduler) initialDelay() time.Duration {
+
+	if s.cron != nil {
+		return s.baseDelay(s.now()) + s.randomJitter()
+	}
+	return s.randomJitter()
+}
+
+// next returns the delay until the poll after one with the given outcome.
+func (s *feedScheduler) next(res pollResult, err error) time.Duration {
+
+	now := s.now()
+	if err != nil {
+		s.failures++
+		backoff := s.baseDelay(now)
+		for i := 0; i < s.failures && backoff < s.maxBackoff; i++ {
+			backoff *= 2
+		}
+		backoff = min(backoff, s.maxBackoff)
+		if s.cron != nil {
+			// Back off to a slot on the schedule rather than between slots.
+			backoff = s.cron.Next(now.Add(backoff).Add(-time.Second).In(s.loc)).Sub(now)
+		}
+		return backoff + s.randomJitter()
+	}
+	s.failures = 0
+	if s.adaptive != nil && s.cron == nil && len(s.windows) == 0 {
+		switch {
+		case res.itemsNew == 0:
+			s.interval = s.clamp(time.Duration(float64(s.interval) * adaptiveGrowFactor))
+		case res.itemsNew*2 >= res.itemsSeen:
+			s.interval = s.clamp(time.Duration(float64(s.interval) * adaptiveShrinkFactor))
+		}
+	}
+	return s.baseDelay(now) + s.randomJitter()
+}
+
+func (s *feedScheduler) clamp(d time.Duration) time.Duration {
+
+	if s.adaptive.MinInterval > 0 {
+		d = max(d, s.adaptive.MinInterval)
+	}
+	if s.adaptive.MaxInterval > 0 {
+		d = min(d, s.adaptive.MaxInterval)
+	}
+	return d
+}
+
+func (s *feedScheduler) randomJitter() time.Duration {
+
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(s.randN(int64(s.jitter)))
+}
+
+// describe summarises the schedule for status reporting.
+func (s *feedScheduler) describe() string {
+
+	var ret string
+	switch {
+	case s.cron != nil:
+		ret = fmt.Sprintf("cron %s (%s)", s.cronExpr, s.loc)
+	case len(s.windows) > 0:
+		now := s.now()
+		ret = fmt.Sprintf("every %s", s.intervalAt(now))
+		if i := s.window(now); i >= 0 {
+			ret += fmt.Sprintf(" (window %s %s)", s.windows[i].desc, s.loc)
+		} else {
+			ret += fmt.Sprintf(" (outside windows, %s)", s.loc)
+		}
+	default:
+		ret = fmt.Sprintf("every %s", s.interval)
+		if s.adaptive != nil {
+			ret += fmt.Sprintf(" (adaptive, %s-%s)", s.adaptive.MinInterval, s.adaptive.MaxInterval)
+		}
+	}
+	if s.failures > 0 {
+		ret += fmt.Sprintf(", backing off after %d failures", s.failures)
+	}
+	return ret
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noJitter(s *feedScheduler, err error) *feedScheduler {
+	if err != nil {
+		panic(err)
+	}
+	s.randN = func(n int64) int64 {
+		return 0
+	}
+	return s
+}
+
+func TestFeedScheduler_BacksOffOnErrors(t *testing.T) {
+
+	s := noJitter(newFeedScheduler(RSSFeed{PollInterval: time.Minute, MaxBackoff: 5 * time.Minute}))
+	err := errors.New("boom")
+	assert.Equal(t, 2*time.Minute, s.next(pollResult{}, err))
+	assert.Equal(t, 4*time.Minute, s.next(pollResult{}, err))
+	assert.Equal(t, 5*time.Minute, s.next(pollResult{}, err))
+	assert.Equal(t, time.Minute, s.next(pollResult{}, nil))
+}
+
+func TestFeedScheduler_Adapts(t *testing.T) {
+
+	s := noJitter(newFeedScheduler(RSSFeed{
+		PollInterval: 10 * time.Minute,
+		Adaptive:     &AdaptiveIntervalConfig{MinInterval: 4 * time.Minute, MaxInterval: 20 * time.Minute},
+	}))
+	assert.Equal(t, 15*time.Minute, s.next(pollResult{itemsSeen: 10}, nil))
+	assert.Equal(t, 20*time.Minute, s.next(pollResult{itemsSeen: 10}, nil))
+	assert.Equal(t, 20*time.Minute, s.next(pollResult{itemsSeen: 10, itemsNew: 1}, nil))
+	assert.Equal(t, 10*time.Minute, s.next(pollResult{itemsSeen: 10, itemsNew: 8}, nil))
+	assert.Equal(t, 5*time.Minute, s.next(pollResult{itemsSeen: 10, itemsNew: 8}, nil))
+	assert.Equal(t, 4*time.Minute, s.next(pollResult{itemsSeen: 10, itemsNew: 8}, nil))
+}
+
+func TestFeedScheduler_Jitter(t *testing.T) {
+
+	s, err := newFeedScheduler(RSSFeed{PollInterval: time.Minute})
+	assert.NoError(t, err)
+	for range 100 {
+		d := s.next(pollResult{}, nil)
+		assert.True(t, d >= time.Minute && d < time.Minute+6*time.Second, d)
+	}
+}
+
+func TestFeedScheduler_Cron(t *testing.T) {
+
+	s := noJitter(newFeedScheduler(RSSFeed{Cron: "0,20,40 * * * *", Timezone: "Australia/Sydney"}))
+	now := time.Date(2024, 6, 1, 10, 5, 0, 0, s.loc)
+	s.now = func() time.Time { return now }
+	assert.Equal(t, 15*time.Minute, s.initialDelay())
+	assert.Equal(t, 15*time.Minute, s.next(pollResult{}, nil))
+
+	now = time.Date(2024, 6, 1, 10, 20, 0, 0, s.loc)
+	err := errors.New("boom")
+	assert.Equal(t, 40*time.Minute, s.next(pollResult{}, err))
+	assert.Equal(t, 60*time.Minute, s.next(pollResult{}, err))
+}
+
+func TestFeedScheduler_Windows(t *testing.T) {
+
+	s := noJitter(newFeedScheduler(RSSFeed{
+		PollInterval: 10 * time.Minute,
+		Timezone:     "Europe/London",
+		Windows: []PollWindow{
+			{From: "23:00", To: "07:00", Interval: time.Hour},
+			{From: "12:00", To: "14:00", Interval: 5 * time.Minute, Days: []string{"sat", "sun"}},
+		},
+	}))
+	var now time.Time
+	s.now = func() time.Time { return now }
+
+	now = time.Date(2024, 6, 1, 2, 0, 0, 0, s.loc)
+	assert.Equal(t, time.Hour, s.next(pollResult{}, nil))
+	// The quiet window closes at 07:00, so the next poll is then.
+	now = time.Date(2024, 6, 1, 6, 30, 0, 0, s.loc)
+	assert.Equal(t, 30*time.Minute, s.next(pollResult{}, nil))
+	now = time.Date(2024, 6, 1, 9, 0, 0, 0, s.loc)
+	assert.Equal(t, 10*time.Minute, s.next(pollResult{}, nil))
+	// 2024-06-01 is a Saturday.
+	now = time.Date(2024, 6, 1, 12, 30, 0, 0, s.loc)
+	assert.Equal(t, 5*time.Minute, s.next(pollResult{}, nil))
+	now = time.Date(2024, 6, 3, 12, 30, 0, 0, s.loc)
+	assert.Equal(t, 10*time.Minute, s.next(pollResult{}, nil))
+}
+
+func TestNewFeedScheduler_Invalid(t *testing.T) {
+
+	for _, feed := range []RSSFeed{
+		{Name: "a"},
+		{Name: "b", Cron: "not a cron"},
+		{Name: "c", Cron: "* * * * *", Windows: []PollWindow{{From: "01:00", To: "02:00", Interval: time.Minute}}},
+		{Name: "d", PollInterval: time.Minute, Windows: []PollWindow{{From: "1am", To: "02:00", Interval: time.Minute}}},
+		{Name: "e", PollInterval: time.Minute, Windows: []PollWindow{{From: "01:00", To: "02:00"}}},
+		{Name: "f", PollInterval: time.Minute, Timezone: "Mars/Olympus_Mons"},
+	} {
+		_, err := newFeedScheduler(feed)
+		assert.Error(t, err, feed.Name)
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+)
+
+const (
+	defaultSearchLogLimit = 100
+	maxSearchLogLimit     = 1000
+)
+
+// logSearch completes entry with the search's params and outcome and
+// records it in the search log. Failing to record it doesn't fail the
+// search.
+func (p *Proxy) logSearch(ctx context.Context, params newznab.SearchParams, entry SearchLogEntry, ret *newznab.RssFeed, err error) {
+
+	entry.Query = params.Query
+	entry.APIKey = newznab.APIKeyFromContext(ctx)
+	entry.LatencyMS = time.Since(entry.SearchedAt).Milliseconds()
+	if v, encErr := params.Values(); encErr == nil {
+		v.Del("q")
+		entry.Params = v.Encode()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else if ret != nil {
+		entry.Results = len(ret.Channel.Items)
+	}
+	// The client may have gone away by now, but the search still happened.
+	_, logErr := p.s.InsertSearchLog(context.WithoutCancel(ctx), entry)
+	if logErr != nil {
+		slog.WarnContext(ctx, "failed to record search", "query", entry.Query, "err", logErr)
+	}
+}
+
+// SearchLog lists logged searches, newest first.
+func (p *Proxy) SearchLog(ctx context.Context, q SearchLogQuery) ([]SearchLogEntry, error) {
+
+	q.Limit = searchLogLimit(q.Limit)
+	return p.s.ListSearchLog(ctx, q)
+}
+
+// TopQueries lists the queries searched for most often since the given
+// time.
+func (p *Proxy) TopQueries(ctx context.Context, since time.Time, limit int) ([]QueryStats, error) {
+
+	return p.s.GetTopSearchQueries(ctx, since, searchLogLimit(limit), false)
+}
+
+// ZeroResultQueries lists the queries searched for since the given time
+// that never returned anything, most often searched first.
+func (p *Proxy) ZeroResultQueries(ctx context.Context, since time.Time, limit int) ([]QueryStats, error) {
+
+	return p.s.GetTopSearchQueries(ctx, since, searchLogLimit(limit), true)
+}
+
+// BackendContributions summarises each backend's part in the searches
+// since the given time.
+func (p *Proxy) BackendContributions(ctx context.Context, since time.Time) ([]BackendContribution, error) {
+
+	return p.s.GetSearchBackendStats(ctx, since)
+}
+
+func searchLogLimit(limit int) int {
+
+	if limit <= 0 {
+		return defaultSearchLogLimit
+	}
+	return min(limit, maxSearchLogLimit)
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchLog(t *testing.T) {
+
+	ctx := context.Background()
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var items []newznab.Item
+		if r.URL.Query().Get("q") == "some show" {
+			items = []newznab.Item{{Title: "Some.Show.S01E01", GUID: newznab.RssGuid{Value: "1"}}}
+		}
+		body, _ := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, len(items), items))
+		rw.Write(body)
+	}))
+	defer backend.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Backends[0].BaseURL = backend.URL
+	c.Backends[0].RSS = nil
+	c.Backends = append(c.Backends, BackendConfig{Name: "b", BaseURL: failing.URL})
+	p, err := NewProxy(ctx, c)
+	require.NoError(t, err)
+	key := NewAPIKey("sonarr")
+	require.NoError(t, p.s.InsertAPIKey(ctx, key))
+	for _, q := range []string{"some show", "Some Show", "nothing"} {
+		_, err = p.Search(newznab.ContextWithAPIKey(ctx, key.Key), newznab.SearchParams{Query: q, Category: "5000"})
+		require.NoError(t, err)
+	}
+	// RSS sync searches are logged too, with an empty query.
+	_, err = p.Search(newznab.ContextWithAPIKey(ctx, key.Key), newznab.SearchParams{})
+	require.NoError(t, err)
+
+	entries, err := p.SearchLog(ctx, SearchLogQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Empty(t, entries[0].Query)
+	assert.Equal(t, 1, entries[0].Results)
+	// The first search went to the backends, the second was answered from
+	// the item the first stored.
+	first, second := entries[3], entries[2]
+	assert.Equal(t, "some show", first.Query)
+	assert.Equal(t, "cat=5000", first.Params)
+	assert.Equal(t, "sonarr", first.APIKeyName)
+	body, err := json.Marshal(entries)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), key.Key)
+	assert.Equal(t, 0, first.LocalResults)
+	assert.Equal(t, 1, first.RemoteResults)
+	assert.Equal(t, 1, first.Results)
+	require.Len(t, first.Backends, 2)
+	assert.Equal(t, SearchLogBackend{IndexerName: "a", Outcome: "hit", Results: 1, LatencyMS: first.Backends[0].LatencyMS}, first.Backends[0])
+	assert.Equal(t, "error", first.Backends[1].Outcome)
+	assert.Equal(t, 1, second.LocalResults)
+	assert.Empty(t, second.Backends)
+
+	entries, err = p.SearchLog(ctx, SearchLogQuery{Query: "noth"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 0, entries[0].Results)
+
+	since := time.Now().Add(-time.Hour)
+	top, err := p.TopQueries(ctx, since, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "some show", top[0].Query)
+	assert.Equal(t, 2, top[0].Searches)
+	zero, err := p.ZeroResultQueries(ctx, since, 10)
+	require.NoError(t, err)
+	require.Len(t, zero, 1)
+	assert.Equal(t, QueryStats{Query: "nothing", Searches: 1, EmptySearches: 1, LastSearched: zero[0].LastSearched}, zero[0])
+
+	contrib, err := p.BackendContributions(ctx, since)
+	require.NoError(t, err)
+	require.Len(t, contrib, 2)
+	assert.Equal(t, "a", contrib[0].IndexerName)
+	assert.Equal(t, 2, contrib[0].Searches)
+	assert.Equal(t, 0.5, contrib[0].HitRate)
+	assert.Equal(t, 1.0, contrib[0].ResultShare)
+	assert.Equal(t, 0, contrib[1].Hits)
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+// healthWindow is how far back searches are counted towards a backend's
+// health, and requests towards its usage.
+const healthWindow = 24 * time.Hour
+
+// BackendStatuses returns the status of every configured backend.
+func (p *Proxy) BackendStatuses(ctx context.Context) ([]BackendStatus, error) {
+
+	set := p.current()
+	since := time.Now().Add(-healthWindow)
+	outcomes, err := p.s.CountSearchOutcomes(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	grabs, err := p.s.CountGrabsSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	polls, err := p.s.CountFeedPollRunsSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := p.FeedStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]BackendStatus, 0, len(set.c.Backends))
+	for _, bcfg := range set.c.Backends {
+		status := BackendStatus{
+			Name:     bcfg.Name,
+			BaseURL:  bcfg.BaseURL,
+			Priority: bcfg.Priority,
+			Healthy:  true,
+			Searches: make(map[SearchResultStatus]int),
+			Usage: BackendUsage{
+				APIRequests: polls[bcfg.Name],
+				Grabs:       grabs[bcfg.Name],
+				APILimit:    bcfg.DailyAPILimit,
+				GrabLimit:   bcfg.DailyGrabLimit,
+			},
+		}
+		var lastSuccess time.Time
+		for st, o := range outcomes[bcfg.Name] {
+			status.Searches[st] = o.count
+			status.Usage.APIRequests += o.count
+			if st != SearchResultStatusError && o.lastTried.After(lastSuccess) {
+				lastSuccess = o.lastTried
+			}
+		}
+		lastErr, err := p.s.GetLastSearchError(ctx, bcfg.Name)
+		if err == nil {
+			status.LastError = lastErr.ErrorMessage
+			status.LastErrorAt = &lastErr.LastTried
+			if lastErr.LastTried.After(lastSuccess) {
+				status.Healthy = false
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		for _, f := range feeds {
+			if f.IndexerName != bcfg.Name {
+				continue
+			}
+			status.Feeds++
+			if f.ConsecutiveFailures > 0 {
+				status.FailingFeeds++
+				status.Healthy = false
+			}
+		}
+		ret = append(ret, status)
+	}
+	return ret, nil
+}
+
+// SearchCache lists cached search outcomes, most recently tried first.
+func (p *Proxy) SearchCache(ctx context.Context, q SearchCacheQuery) ([]SearchCacheEntry, error) {
+
+	return p.s.ListSearchCacheEntries(ctx, q)
+}
+
+// PurgeSearchCache forgets the outcomes of searches last tried before the
+// given time, for one backend or all of them if indexer is empty, so that
+// they are retried. It returns the number of entries purged.
+func (p *Proxy) PurgeSearchCache(ctx context.Context, indexer string, before time.Time) (int, error) {
+
+	return p.s.DeleteSearchCacheEntries(ctx, indexer, before)
+}
+
+// RecentItems lists stored items, newest first, without applying filters.
+func (p *Proxy) RecentItems(ctx context.Context, q RecentFeedItemsQuery) ([]FeedItem, error) {
+
+	return p.s.ListRecentFeedItems(ctx, q)
+}
+
+// Grabs lists grabs, newest first.
+func (p *Proxy) Grabs(ctx context.Context, q GrabQuery) ([]Grab, error) {
+
+	return p.s.ListGrabs(ctx, q)
+}
+
+// GrabStats summarises the grabs from each indexer since the given time,
+// optionally only those made with apiKey, which may be a key or its name.
+func (p *Proxy) GrabStats(ctx context.Context, since time.Time, apiKey string) ([]GrabStats, error) {
+
+	return p.s.GetGrabStats(ctx, since, apiKey)
+}
+
+// ReleaseGrabs reports whether a release has been grabbed before. The
+// release is identified by the id of a stored item, by title, or both; an
+// item's title is matched too, so that a grab of the same release from
+// another indexer is found.
+func (p *Proxy) ReleaseGrabs(ctx context.Context, id, title string) (ReleaseGrabs, error) {
+
+	if id == "" && title == "" {
+		return ReleaseGrabs{}, errors.New("an id or title is required")
+	}
+	if id != "" && title == "" {
+		fi, err := p.s.GetFeedItemByUUID(ctx, id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return ReleaseGrabs{}, err
+		}
+		title = fi.Title
+	}
+	grabs, err := p.s.ListGrabsOfRelease(ctx, id, title)
+	if err != nil {
+		return ReleaseGrabs{}, err
+	}
+	return ReleaseGrabs{
+		Grabbed: slices.ContainsFunc(grabs, func(g Grab) bool {
+			return g.Error == ""
+		}),
+		Grabs: grabs,
+	}, nil
+}
+
+// CheckSearchIndex reports whether the search index matches the stored
+// items.
+func (p *Proxy) CheckSearchIndex(ctx context.Context) (SearchIndexStatus, error) {
+
+	return p.s.CheckSearchIndex(ctx)
+}
+
+// RebuildSearchIndex rebuilds the search index from the stored items.
+func (p *Proxy) RebuildSearchIndex(ctx context.Context) error {
+
+	return p.s.RebuildSearchIndex(ctx)
+}
@@ -3,12 +3,14 @@ package proxy
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/henges/newznab-proxy/proxy/querier"
 	"github.com/samber/lo"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 type Store struct {
@@ -26,7 +28,7 @@ func NewStore(ctx context.Context, path string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Store{db: db, q: querier.New(db)}, nil
+	return &Store{db: db, q: querier.New(tracedDB{db: db})}, nil
 }
 
 func nullStr(s string) sql.NullString {
@@ -77,6 +79,9 @@ func (s *Store) InsertFeedItem(ctx context.Context, fi FeedItem) error {
 		return err
 	}
 	for k, v := range fi.Attrs {
+		if k == "category" && len(fi.Categories) > 0 {
+			continue
+		}
 		err = s.q.InsertFeedItemMeta(ctx, querier.InsertFeedItemMetaParams{
 			FeedItemID: res,
 			Name:       k,
@@ -86,6 +91,18 @@ func (s *Store) InsertFeedItem(ctx context.Context, fi FeedItem) error {
 			return err
 		}
 	}
+	// Each category gets a row of its own, so that searches by category
+	// match any of them.
+	for _, c := range fi.Categories {
+		err = s.q.InsertFeedItemMeta(ctx, querier.InsertFeedItemMetaParams{
+			FeedItemID: res,
+			Name:       "category",
+			Value:      c,
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -95,6 +112,50 @@ func (s *Store) SearchForFeedItem(ctx context.Context, search string) ([]FeedIte
 	if err != nil {
 		return nil, err
 	}
+	return s.feedItemsFromRows(ctx, rows)
+}
+
+func (s *Store) GetFeedItemByUUID(ctx context.Context, id string) (FeedItem, error) {
+
+	row, err := s.q.GetFeedItemByUUID(ctx, id)
+	if err != nil {
+		return FeedItem{}, err
+	}
+	ret, err := s.feedItemsFromRows(ctx, []querier.FeedItem{row})
+	if err != nil {
+		return FeedItem{}, err
+	}
+	return ret[0], nil
+}
+
+// ListRecentFeedItems returns the most recently published items matching q.
+func (s *Store) ListRecentFeedItems(ctx context.Context, q RecentFeedItemsQuery) ([]FeedItem, error) {
+
+	var parents []int64
+	for _, c := range q.Categories {
+		if id, ok := parentCategory(c); ok {
+			parents = append(parents, id)
+		}
+	}
+	rows, err := s.q.ListRecentFeedItems(ctx, querier.ListRecentFeedItemsParams{
+		AnyIndexer:       len(q.Indexers) == 0,
+		Indexers:         q.Indexers,
+		AnyCategory:      len(q.Categories) == 0,
+		Categories:       q.Categories,
+		ParentCategories: parents,
+		RowLimit:         int64(q.Limit),
+		RowOffset:        int64(q.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.feedItemsFromRows(ctx, rows)
+}
+
+// feedItemsFromRows converts rows to FeedItems, loading the attrs of each
+// from feed_item_meta.
+func (s *Store) feedItemsFromRows(ctx context.Context, rows []querier.FeedItem) ([]FeedItem, error) {
+
 	ids := lo.Map(rows, func(item querier.FeedItem, index int) int64 {
 		return item.ID
 	})
@@ -108,7 +169,7 @@ func (s *Store) SearchForFeedItem(ctx context.Context, search string) ([]FeedIte
 		if item.GuidIsPermalink == 1 {
 			guidIsPermalink = true
 		}
-		meta, _ := metas[item.ID]
+		meta := metas[item.ID]
 
 		pubDate, _ := timeFromString(item.PubDate)
 
@@ -122,7 +183,9 @@ func (s *Store) SearchForFeedItem(ctx context.Context, search string) ([]FeedIte
 			PubDate:         pubDate,
 			NZBLink:         item.NzbUrl,
 			Size:            item.Size.Int64,
-			Attrs:           meta,
+			Source:          FeedItemSource(item.Source),
+			Attrs:           meta.attrs,
+			Categories:      meta.categories,
 		}
 	})
 	return ret, nil
@@ -138,20 +201,29 @@ func timeFromString(s string) (time.Time, error) {
 	return time.Parse(time.RFC3339, s)
 }
 
-func (s *Store) GetFeedItemMetas(ctx context.Context, ids []int64) (map[int64]map[string]string, error) {
+// feedItemMeta is an item's attrs as loaded from feed_item_meta.
+type feedItemMeta struct {
+	attrs      map[string]string
+	categories []string
+}
+
+func (s *Store) GetFeedItemMetas(ctx context.Context, ids []int64) (map[int64]feedItemMeta, error) {
 
 	metas, err := s.q.GetFeedItemMetas(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
-	ret := make(map[int64]map[string]string)
+	ret := make(map[int64]feedItemMeta)
 	for _, meta := range metas {
 		existing, ok := ret[meta.FeedItemID]
 		if !ok {
-			existing = make(map[string]string)
-			ret[meta.FeedItemID] = existing
+			existing.attrs = make(map[string]string)
+		}
+		existing.attrs[meta.Name] = meta.Value
+		if meta.Name == "category" {
+			existing.categories = append(existing.categories, meta.Value)
 		}
-		existing[meta.Name] = meta.Value
+		ret[meta.FeedItemID] = existing
 	}
 	return ret, nil
 }
@@ -225,3 +297,664 @@ func (s *Store) GetNZBDataByUUID(ctx context.Context, id string) (NZBData, error
 	}
 	return ret, nil
 }
+
+func (s *Store) GetFeedPollState(ctx context.Context, indexer, feed string) (FeedPollState, error) {
+
+	row, err := s.q.GetFeedPollState(ctx, querier.GetFeedPollStateParams{
+		IndexerName: indexer,
+		FeedName:    feed,
+	})
+	if err != nil {
+		return FeedPollState{}, err
+	}
+	lastPubDate, _ := timeFromString(row.LastPubDate)
+	return FeedPollState{
+		IndexerName:       row.IndexerName,
+		FeedName:          row.FeedName,
+		LastGUID:          row.LastGuid,
+		LastPubDate:       lastPubDate,
+		OffsetUnsupported: row.OffsetUnsupported == 1,
+		UpdatedAt:         time.Unix(row.UpdatedAt, 0),
+	}, nil
+}
+
+func (s *Store) UpsertFeedPollState(ctx context.Context, state FeedPollState) error {
+
+	offsetUnsupported := int64(0)
+	if state.OffsetUnsupported {
+		offsetUnsupported = 1
+	}
+	return s.q.UpsertFeedPollState(ctx, querier.UpsertFeedPollStateParams{
+		IndexerName:       state.IndexerName,
+		FeedName:          state.FeedName,
+		LastGuid:          state.LastGUID,
+		LastPubDate:       timeToString(state.LastPubDate),
+		OffsetUnsupported: offsetUnsupported,
+		UpdatedAt:         state.UpdatedAt.Unix(),
+	})
+}
+
+func (s *Store) InsertFeedPollRun(ctx context.Context, run FeedPollRun) error {
+
+	return s.q.InsertFeedPollRun(ctx, querier.InsertFeedPollRunParams{
+		IndexerName: run.IndexerName,
+		FeedName:    run.FeedName,
+		StartedAt:   run.StartedAt.Unix(),
+		FinishedAt:  run.FinishedAt.Unix(),
+		ItemsSeen:   int64(run.ItemsSeen),
+		ItemsNew:    int64(run.ItemsNew),
+		HttpStatus: sql.NullInt64{
+			Int64: int64(run.HTTPStatus),
+			Valid: run.HTTPStatus != 0,
+		},
+		Error: nullStr(run.Error),
+	})
+}
+
+func (s *Store) ListFeedPollRuns(ctx context.Context, indexer, feed string, limit int) ([]FeedPollRun, error) {
+
+	rows, err := s.q.ListFeedPollRuns(ctx, querier.ListFeedPollRunsParams{
+		IndexerName: indexer,
+		FeedName:    feed,
+		Limit:       int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.FeedPollRun, index int) FeedPollRun {
+		return feedPollRunFromRow(item)
+	}), nil
+}
+
+// GetFeedStatus fills in the parts of a feed's status derived from its poll
+// history.
+func (s *Store) GetFeedStatus(ctx context.Context, indexer, feed string) (FeedStatus, error) {
+
+	ret := FeedStatus{
+		IndexerName: indexer,
+		FeedName:    feed,
+	}
+	runs, err := s.ListFeedPollRuns(ctx, indexer, feed, 1)
+	if err != nil {
+		return ret, err
+	}
+	if len(runs) == 0 {
+		return ret, nil
+	}
+	ret.LastRun = &runs[0]
+
+	var lastSuccessID int64
+	lastSuccess, err := s.q.GetLastSuccessfulFeedPollRun(ctx, querier.GetLastSuccessfulFeedPollRunParams{
+		IndexerName: indexer,
+		FeedName:    feed,
+	})
+	if err == nil {
+		t := time.Unix(lastSuccess.FinishedAt, 0)
+		ret.LastSuccess = &t
+		lastSuccessID = lastSuccess.ID
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return ret, err
+	}
+	failures, err := s.q.CountFeedPollRunsAfter(ctx, querier.CountFeedPollRunsAfterParams{
+		IndexerName: indexer,
+		FeedName:    feed,
+		ID:          lastSuccessID,
+	})
+	if err != nil {
+		return ret, err
+	}
+	ret.ConsecutiveFailures = int(failures)
+	return ret, nil
+}
+
+func feedPollRunFromRow(row querier.FeedPollRun) FeedPollRun {
+
+	return FeedPollRun{
+		ID:          row.ID,
+		IndexerName: row.IndexerName,
+		FeedName:    row.FeedName,
+		StartedAt:   time.Unix(row.StartedAt, 0),
+		FinishedAt:  time.Unix(row.FinishedAt, 0),
+		ItemsSeen:   int(row.ItemsSeen),
+		ItemsNew:    int(row.ItemsNew),
+		HTTPStatus:  int(row.HttpStatus.Int64),
+		Error:       row.Error.String,
+	}
+}
+
+func (s *Store) InsertAPIKey(ctx context.Context, key APIKey) error {
+
+	return s.q.InsertAPIKey(ctx, querier.InsertAPIKeyParams{
+		Key:       key.Key,
+		Name:      key.Name,
+		CreatedAt: key.CreatedAt.Unix(),
+	})
+}
+
+// RevokeAPIKey revokes the active key with the given key or name, returning
+// sql.ErrNoRows if there is none.
+func (s *Store) RevokeAPIKey(ctx context.Context, keyOrName string, at time.Time) error {
+
+	n, err := s.q.RevokeAPIKey(ctx, querier.RevokeAPIKeyParams{
+		RevokedAt: sql.NullInt64{Int64: at.Unix(), Valid: true},
+		Key:       keyOrName,
+		Name:      keyOrName,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+
+	rows, err := s.q.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.ApiKey, index int) APIKey {
+		ret := APIKey{
+			Key:       item.Key,
+			Name:      item.Name,
+			CreatedAt: time.Unix(item.CreatedAt, 0),
+		}
+		if item.RevokedAt.Valid {
+			t := time.Unix(item.RevokedAt.Int64, 0)
+			ret.RevokedAt = &t
+		}
+		return ret
+	}), nil
+}
+
+func (s *Store) ListActiveAPIKeys(ctx context.Context) ([]string, error) {
+
+	return s.q.ListActiveAPIKeys(ctx)
+}
+
+func (s *Store) GetDBStats(ctx context.Context) (DBStats, error) {
+
+	row, err := s.q.GetDBStats(ctx)
+	if err != nil {
+		return DBStats{}, err
+	}
+	counts, err := s.q.CountFeedItemsByIndexer(ctx)
+	if err != nil {
+		return DBStats{}, err
+	}
+	return DBStats{
+		FeedItems:          int(row.FeedItems),
+		FeedItemMeta:       int(row.FeedItemMeta),
+		SearchCacheEntries: int(row.SearchCacheEntries),
+		FeedPollRuns:       int(row.FeedPollRuns),
+		APIKeys:            int(row.ApiKeys),
+		ItemsByIndexer: lo.Map(counts, func(item querier.CountFeedItemsByIndexerRow, index int) IndexerItemCount {
+			return IndexerItemCount{
+				IndexerName: item.IndexerName,
+				Source:      FeedItemSource(item.Source),
+				Items:       int(item.Items),
+			}
+		}),
+	}, nil
+}
+
+// DeleteSearchCacheEntries deletes the cached search outcomes last tried
+// before the given time, for one indexer or all of them if indexer is empty.
+// It returns the number deleted.
+func (s *Store) DeleteSearchCacheEntries(ctx context.Context, indexer string, before time.Time) (int, error) {
+
+	n, err := s.q.DeleteSearchCacheEntries(ctx, querier.DeleteSearchCacheEntriesParams{
+		AnyIndexer:  indexer == "",
+		IndexerName: indexer,
+		Before:      before.Unix(),
+	})
+	return int(n), err
+}
+
+// Size returns the size of the database in bytes. It's queried directly, as
+// sqlc can't parse pragma functions.
+func (s *Store) Size(ctx context.Context) (int64, error) {
+
+	var ret int64
+	err := s.db.QueryRowContext(ctx, "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&ret)
+	return ret, err
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) ListSearchCacheEntries(ctx context.Context, q SearchCacheQuery) ([]SearchCacheEntry, error) {
+
+	rows, err := s.q.ListSearchCacheEntries(ctx, querier.ListSearchCacheEntriesParams{
+		AnyIndexer:   q.IndexerName == "",
+		IndexerName:  q.IndexerName,
+		AnyStatus:    q.Status == "",
+		Status:       string(q.Status),
+		QueryPattern: "%" + q.Query + "%",
+		RowLimit:     int64(q.Limit),
+		RowOffset:    int64(q.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.SearchCache, index int) SearchCacheEntry {
+		return searchCacheEntryFromRow(item)
+	}), nil
+}
+
+func searchCacheEntryFromRow(row querier.SearchCache) SearchCacheEntry {
+
+	return SearchCacheEntry{
+		IndexerName:        row.IndexerName,
+		Query:              row.Query,
+		FirstTried:         time.Unix(row.FirstTried, 0),
+		LastTried:          time.Unix(row.LastTried, 0),
+		SearchResultStatus: SearchResultStatus(row.Status),
+		ErrorMessage:       row.ErrorMessage.String,
+	}
+}
+
+// searchOutcome is the number of searches of an indexer with a status, and
+// when the last of them was tried.
+type searchOutcome struct {
+	count     int
+	lastTried time.Time
+}
+
+// CountSearchOutcomes counts the search cache entries tried since the given
+// time, by indexer and status.
+func (s *Store) CountSearchOutcomes(ctx context.Context, since time.Time) (map[string]map[SearchResultStatus]searchOutcome, error) {
+
+	rows, err := s.q.CountSearchCacheOutcomes(ctx, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]map[SearchResultStatus]searchOutcome)
+	for _, row := range rows {
+		if ret[row.IndexerName] == nil {
+			ret[row.IndexerName] = make(map[SearchResultStatus]searchOutcome)
+		}
+		lastTried, _ := row.LastTried.(int64)
+		ret[row.IndexerName][SearchResultStatus(row.Status)] = searchOutcome{
+			count:     int(row.Entries),
+			lastTried: time.Unix(lastTried, 0),
+		}
+	}
+	return ret, nil
+}
+
+// GetLastSearchError returns the most recent failed search of an indexer,
+// or sql.ErrNoRows if there is none.
+func (s *Store) GetLastSearchError(ctx context.Context, indexer string) (SearchCacheEntry, error) {
+
+	row, err := s.q.GetLastSearchCacheError(ctx, indexer)
+	if err != nil {
+		return SearchCacheEntry{}, err
+	}
+	return searchCacheEntryFromRow(row), nil
+}
+
+func (s *Store) InsertGrab(ctx context.Context, g Grab) error {
+
+	return s.q.InsertGrab(ctx, querier.InsertGrabParams{
+		FeedItemUuid: g.FeedItemID,
+		IndexerName:  g.IndexerName,
+		Title:        g.Title,
+		ApiKey:       nullStr(g.APIKey),
+		GrabbedAt:    g.GrabbedAt.Unix(),
+		Size:         int64(g.Size),
+		Error:        nullStr(g.Error),
+	})
+}
+
+func (s *Store) ListGrabs(ctx context.Context, q GrabQuery) ([]Grab, error) {
+
+	rows, err := s.q.ListGrabs(ctx, querier.ListGrabsParams{
+		AnyIndexer:   q.IndexerName == "",
+		IndexerName:  q.IndexerName,
+		AnyItem:      q.FeedItemID == "",
+		FeedItemUuid: q.FeedItemID,
+		AnyApiKey:    q.APIKey == "",
+		ApiKey:       nullStr(q.APIKey),
+		AnyOutcome:   q.Succeeded == nil,
+		Succeeded:    q.Succeeded != nil && *q.Succeeded,
+		TitlePattern: "%" + q.Title + "%",
+		Since:        q.Since.Unix(),
+		RowLimit:     int64(q.Limit),
+		RowOffset:    int64(q.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.ListGrabsRow, index int) Grab {
+		return grabFromRow(querier.ListGrabsOfReleaseRow(item))
+	}), nil
+}
+
+// ListGrabsOfRelease lists the grabs of the item with id, or of any item
+// with the same title, newest first.
+func (s *Store) ListGrabsOfRelease(ctx context.Context, id, title string) ([]Grab, error) {
+
+	rows, err := s.q.ListGrabsOfRelease(ctx, querier.ListGrabsOfReleaseParams{
+		FeedItemUuid: id,
+		Title:        title,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.ListGrabsOfReleaseRow, index int) Grab {
+		return grabFromRow(item)
+	}), nil
+}
+
+func grabFromRow(row querier.ListGrabsOfReleaseRow) Grab {
+
+	return Grab{
+		ID:          row.ID,
+		FeedItemID:  row.FeedItemUuid,
+		IndexerName: row.IndexerName,
+		Title:       row.Title,
+		APIKey:      row.ApiKey.String,
+		APIKeyName:  row.ApiKeyName.String,
+		GrabbedAt:   time.Unix(row.GrabbedAt, 0),
+		Size:        int(row.Size),
+		Error:       row.Error.String,
+	}
+}
+
+// GetGrabStats summarises the grabs since the given time by indexer,
+// optionally only those made with apiKey, which may be a key or its name.
+func (s *Store) GetGrabStats(ctx context.Context, since time.Time, apiKey string) ([]GrabStats, error) {
+
+	rows, err := s.q.GetGrabStats(ctx, querier.GetGrabStatsParams{
+		Since:     since.Unix(),
+		AnyApiKey: apiKey == "",
+		ApiKey:    nullStr(apiKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.GetGrabStatsRow, index int) GrabStats {
+		return GrabStats{
+			IndexerName: item.IndexerName,
+			Grabs:       int(item.Grabs),
+			Failed:      int(item.Failed),
+			Bytes:       item.Bytes,
+			LastGrabbed: time.Unix(item.LastGrabbed, 0),
+		}
+	}), nil
+}
+
+// CountGrabsSince counts the successful grabs since the given time by
+// indexer.
+func (s *Store) CountGrabsSince(ctx context.Context, since time.Time) (map[string]int, error) {
+
+	rows, err := s.q.CountGrabsSince(ctx, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return lo.Associate(rows, func(item querier.CountGrabsSinceRow) (string, int) {
+		return item.IndexerName, int(item.Grabs)
+	}), nil
+}
+
+// CountFeedPollRunsSince counts the RSS polls started since the given time
+// by indexer.
+func (s *Store) CountFeedPollRunsSince(ctx context.Context, since time.Time) (map[string]int, error) {
+
+	rows, err := s.q.CountFeedPollRunsSince(ctx, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return lo.Associate(rows, func(item querier.CountFeedPollRunsSinceRow) (string, int) {
+		return item.IndexerName, int(item.Runs)
+	}), nil
+}
+
+// InsertSearchLog records a search along with its backends' outcomes,
+// returning the entry's id.
+func (s *Store) InsertSearchLog(ctx context.Context, e SearchLogEntry) (int64, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := s.q.WithTx(tx)
+	id, err := q.InsertSearchLog(ctx, querier.InsertSearchLogParams{
+		SearchedAt:    e.SearchedAt.Unix(),
+		Feed:          nullStr(e.Feed),
+		Query:         e.Query,
+		Params:        e.Params,
+		ApiKey:        nullStr(e.APIKey),
+		LocalResults:  int64(e.LocalResults),
+		RemoteResults: int64(e.RemoteResults),
+		Results:       int64(e.Results),
+		LatencyMs:     e.LatencyMS,
+		Error:         nullStr(e.Error),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range e.Backends {
+		err = q.InsertSearchLogBackend(ctx, querier.InsertSearchLogBackendParams{
+			SearchLogID: id,
+			IndexerName: b.IndexerName,
+			Outcome:     b.Outcome,
+			Results:     int64(b.Results),
+			LatencyMs:   b.LatencyMS,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// ListSearchLog lists logged searches, newest first.
+func (s *Store) ListSearchLog(ctx context.Context, q SearchLogQuery) ([]SearchLogEntry, error) {
+
+	rows, err := s.q.ListSearchLog(ctx, querier.ListSearchLogParams{
+		Since:        q.Since.Unix(),
+		QueryPattern: "%" + q.Query + "%",
+		RowLimit:     int64(q.Limit),
+		RowOffset:    int64(q.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []SearchLogEntry{}, nil
+	}
+	backends, err := s.q.ListSearchLogBackends(ctx, lo.Map(rows, func(item querier.ListSearchLogRow, index int) int64 {
+		return item.ID
+	}))
+	if err != nil {
+		return nil, err
+	}
+	byEntry := lo.GroupBy(backends, func(item querier.SearchLogBackend) int64 {
+		return item.SearchLogID
+	})
+	return lo.Map(rows, func(item querier.ListSearchLogRow, index int) SearchLogEntry {
+		return SearchLogEntry{
+			ID:            item.ID,
+			SearchedAt:    time.Unix(item.SearchedAt, 0),
+			Feed:          item.Feed.String,
+			Query:         item.Query,
+			Params:        item.Params,
+			APIKey:        item.ApiKey.String,
+			APIKeyName:    item.ApiKeyName.String,
+			LocalResults:  int(item.LocalResults),
+			RemoteResults: int(item.RemoteResults),
+			Results:       int(item.Results),
+			LatencyMS:     item.LatencyMs,
+			Error:         item.Error.String,
+			Backends: lo.Map(byEntry[item.ID], func(b querier.SearchLogBackend, index int) SearchLogBackend {
+				return SearchLogBackend{
+					IndexerName: b.IndexerName,
+					Outcome:     b.Outcome,
+					Results:     int(b.Results),
+					LatencyMS:   b.LatencyMs,
+				}
+			}),
+		}
+	}), nil
+}
+
+// GetTopSearchQueries lists the queries searched for most often since the
+// given time, or if zeroOnly is set, only those that never found anything.
+func (s *Store) GetTopSearchQueries(ctx context.Context, since time.Time, limit int, zeroOnly bool) ([]QueryStats, error) {
+
+	rows, err := s.q.GetTopSearchQueries(ctx, querier.GetTopSearchQueriesParams{
+		Since:      since.Unix(),
+		AnyResults: !zeroOnly,
+		RowLimit:   int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.GetTopSearchQueriesRow, index int) QueryStats {
+		return QueryStats{
+			Query:         item.Query,
+			Searches:      int(item.Searches),
+			EmptySearches: int(item.EmptySearches),
+			LastSearched:  time.Unix(item.LastSearched, 0),
+		}
+	}), nil
+}
+
+// GetSearchBackendStats summarises each backend's part in the searches
+// logged since the given time.
+func (s *Store) GetSearchBackendStats(ctx context.Context, since time.Time) ([]BackendContribution, error) {
+
+	rows, err := s.q.GetSearchBackendStats(ctx, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	total := lo.SumBy(rows, func(item querier.GetSearchBackendStatsRow) int64 {
+		return item.Results
+	})
+	return lo.Map(rows, func(item querier.GetSearchBackendStatsRow, index int) BackendContribution {
+		c := BackendContribution{
+			IndexerName:  item.IndexerName,
+			Searches:     int(item.Searches),
+			Hits:         int(item.Hits),
+			Misses:       int(item.Misses),
+			Errors:       int(item.Errors),
+			Skips:        int(item.Skips),
+			Results:      int(item.Results),
+			AvgLatencyMS: item.AvgLatencyMs,
+		}
+		if sent := item.Searches - item.Skips; sent > 0 {
+			c.HitRate = float64(item.Hits) / float64(sent)
+		}
+		if total > 0 {
+			c.ResultShare = float64(item.Results) / float64(total)
+		}
+		return c
+	}), nil
+}
+
+// ListFeedItemSources lists the backends and sources that stored items are
+// from, leaving Items unset.
+func (s *Store) ListFeedItemSources(ctx context.Context) ([]IndexerItemCount, error) {
+
+	rows, err := s.q.ListFeedItemSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(rows, func(item querier.ListFeedItemSourcesRow, index int) IndexerItemCount {
+		return IndexerItemCount{
+			IndexerName: item.IndexerName,
+			Source:      FeedItemSource(item.Source),
+		}
+	}), nil
+}
+
+// DeleteExpiredFeedItems deletes up to limit of the items selected by q,
+// oldest first, along with their attrs, returning how many were deleted.
+// Triggers remove them from the search index.
+func (s *Store) DeleteExpiredFeedItems(ctx context.Context, q ExpiredFeedItemsQuery, limit int) (int, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := s.q.WithTx(tx)
+	ids, err := qtx.ListExpiredFeedItemIDs(ctx, querier.ListExpiredFeedItemIDsParams{
+		IndexerName: q.IndexerName,
+		Source:      string(q.Source),
+		Before:      q.Before.Unix(),
+		KeepGrabbed: q.KeepGrabbed,
+		RowLimit:    int64(limit),
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	err = qtx.DeleteFeedItemMetas(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	n, err := qtx.DeleteFeedItems(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// Optimize merges the search index, returns free pages to the filesystem and
+// updates the query planner's statistics. It's run directly, as sqlc can't
+// parse these statements.
+func (s *Store) Optimize(ctx context.Context) error {
+
+	for _, stmt := range []string{
+		"INSERT INTO feed_items_fts5(feed_items_fts5) VALUES ('optimize')",
+		"PRAGMA incremental_vacuum",
+		"PRAGMA optimize",
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// CheckSearchIndex runs FTS5's integrity check, which compares the search
+// index with the titles of stored items. Like Optimize, it's run directly.
+func (s *Store) CheckSearchIndex(ctx context.Context) (SearchIndexStatus, error) {
+
+	var ret SearchIndexStatus
+	err := s.db.QueryRowContext(ctx,
+		"SELECT (SELECT count(*) FROM feed_items), (SELECT count(*) FROM feed_items_fts5_docsize)").Scan(&ret.Items, &ret.Indexed)
+	if err != nil {
+		return ret, err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT INTO feed_items_fts5(feed_items_fts5, rank) VALUES ('integrity-check', 1)")
+	if err != nil {
+		// A corrupt index is reported as an error by the statement itself.
+		// Any other error means the check couldn't be made.
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) || sqliteErr.Code()&0xff != sqlite3.SQLITE_CORRUPT {
+			return ret, err
+		}
+		ret.Error = err.Error()
+		return ret, nil
+	}
+	ret.OK = ret.Items == ret.Indexed
+	if !ret.OK {
+		ret.Error = fmt.Sprintf("%d items but %d indexed", ret.Items, ret.Indexed)
+	}
+	return ret, nil
+}
+
+// RebuildSearchIndex discards the search index and rebuilds it from the
+// stored items.
+func (s *Store) RebuildSearchIndex(ctx context.Context) error {
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO feed_items_fts5(feed_items_fts5) VALUES ('rebuild')")
+	return err
+}
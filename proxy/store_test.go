@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_searchIndex(t *testing.T) {
+
+	ctx := context.Background()
+	s, err := NewStore(ctx, filepath.Join(t.TempDir(), "db.sqlite"))
+	require.NoError(t, err)
+	defer s.Close()
+	for _, fi := range []FeedItem{
+		{UUID: "1", IndexerName: "a", Title: "Some.Show.S01E01", Source: FeedItemSourceRSS, PubDate: time.Now()},
+		{UUID: "2", IndexerName: "a", Title: "Other.Show.S01E01", Source: FeedItemSourceRSS, PubDate: time.Now()},
+		{UUID: "3", IndexerName: "a", Title: "Third.Show.S01E01", Source: FeedItemSourceRSS, PubDate: time.Now()},
+	} {
+		require.NoError(t, s.InsertFeedItem(ctx, fi))
+	}
+	search := func(q string) []string {
+		items, err := s.SearchForFeedItem(ctx, q)
+		require.NoError(t, err)
+		return uuids(items)
+	}
+
+	// Updated titles are searched by their new title only.
+	_, err = s.db.ExecContext(ctx, "UPDATE feed_items SET title = 'Renamed.Show.S01E01' WHERE uuid = '1'")
+	require.NoError(t, err)
+	assert.Empty(t, search("some"))
+	assert.Equal(t, []string{"1"}, search("renamed"))
+	_, err = s.db.ExecContext(ctx, "DELETE FROM feed_items WHERE uuid = '2'")
+	require.NoError(t, err)
+	assert.Empty(t, search("other"))
+	status, err := s.CheckSearchIndex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, SearchIndexStatus{OK: true, Items: 2, Indexed: 2}, status)
+
+	// A delete the index doesn't see is caught by the check and fixed by a
+	// rebuild.
+	_, err = s.db.ExecContext(ctx, "DROP TRIGGER feed_items_fts5_delete")
+	require.NoError(t, err)
+	_, err = s.db.ExecContext(ctx, "DELETE FROM feed_items WHERE uuid = '3'")
+	require.NoError(t, err)
+	status, err = s.CheckSearchIndex(ctx)
+	require.NoError(t, err)
+	assert.False(t, status.OK)
+	assert.Contains(t, status.Error, "malformed")
+	// Failing to make the check is an error rather than a failed check.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.CheckSearchIndex(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, s.RebuildSearchIndex(ctx))
+	status, err = s.CheckSearchIndex(ctx)
+	require.NoError(t, err)
+	assert.True(t, status.OK)
+	assert.Empty(t, search("third"))
+}
+
+func TestStore_ListRecentFeedItems_parentCategories(t *testing.T) {
+
+	ctx := context.Background()
+	s, err := NewStore(ctx, filepath.Join(t.TempDir(), "db.sqlite"))
+	require.NoError(t, err)
+	defer s.Close()
+	for i, cat := range []string{"5040", "100040", "105040", "2000"} {
+		require.NoError(t, s.InsertFeedItem(ctx, FeedItem{
+			UUID: cat, IndexerName: "a", Title: "Item." + cat, Source: FeedItemSourceRSS,
+			PubDate: time.Now().Add(-time.Duration(i) * time.Minute), Attrs: map[string]string{"category": cat},
+		}))
+	}
+	recent := func(cats ...string) []string {
+		items, err := s.ListRecentFeedItems(ctx, RecentFeedItemsQuery{Categories: cats, Limit: 10})
+		require.NoError(t, err)
+		return uuids(items)
+	}
+
+	assert.Equal(t, []string{"5040"}, recent("5000"))
+	assert.Equal(t, []string{"100040"}, recent("100000"))
+	assert.Equal(t, []string{"105040", "2000"}, recent("105000", "2000"))
+	assert.True(t, categoryMatches("100000", "100040"))
+	assert.False(t, categoryMatches("100000", "105040"))
+}
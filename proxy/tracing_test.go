@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/xmlutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSearchTracing(t *testing.T) {
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	body, err := xmlutil.Marshal(newznab.NewRssFeedFromItems(0, 1, []newznab.Item{{Title: "Some.Show.S01E01", GUID: newznab.RssGuid{Value: "1"}}}))
+	require.NoError(t, err)
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		rw.Write(body)
+	}))
+	defer backend.Close()
+
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Backends[0].BaseURL = backend.URL
+	c.Backends[0].RSS = nil
+	p, err := NewProxy(context.Background(), c)
+	require.NoError(t, err)
+	srv := httptest.NewServer(newznab.NewServer(p).Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/api?t=search&q=some+show")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := exp.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	root := byName["Server.api"]
+	require.True(t, root.SpanContext.IsValid())
+	assert.Equal(t, root.SpanContext.SpanID(), byName["Proxy.Search"].Parent.SpanID())
+	assert.Equal(t, byName["Proxy.Search"].SpanContext.SpanID(), byName["Client.Search"].Parent.SpanID())
+	assert.Equal(t, byName["Client.Search"].SpanContext.SpanID(), byName["HTTP GET"].Parent.SpanID())
+	assert.Equal(t, byName["Client.Search"].SpanContext.SpanID(), byName["xml.decode"].Parent.SpanID())
+	assert.Contains(t, traceparent, root.SpanContext.TraceID().String())
+	assert.Equal(t, byName["Proxy.Search"].SpanContext.SpanID(), byName["db SearchForFeedItem"].Parent.SpanID())
+	for _, s := range spans {
+		assert.Equal(t, root.SpanContext.TraceID(), s.SpanContext.TraceID(), s.Name)
+	}
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/henges/newznab-proxy/logging"
+)
+
+// FieldError is a problem with the config value at Path.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found with a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, "invalid config:")
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks c for mistakes that would otherwise only show up at
+// runtime, returning a ValidationError listing all of them.
+func (c *Config) Validate() error {
+
+	var v validator
+	if c.Web.ExternalHost == "" {
+		v.add("web.externalHost", "must be set")
+	}
+	if c.Web.Port == 0 {
+		v.add("web.port", "must be set")
+	}
+	if c.Web.LinkTTL < 0 {
+		v.add("web.linkTtl", "must not be negative")
+	}
+	if c.Storage.DBPath == "" {
+		v.add("storage.dbPath", "must be set")
+	} else if err := checkWritableDir(filepath.Dir(c.Storage.DBPath)); err != nil {
+		v.add("storage.dbPath", "%s", err)
+	}
+	if c.Storage.NZBDir != "" {
+		if err := checkWritableDir(c.Storage.NZBDir); err != nil {
+			v.add("storage.nzbDir", "%s", err)
+		}
+	}
+
+	backends := make(map[string]bool, len(c.Backends))
+	for i, b := range c.Backends {
+		path := fmt.Sprintf("backends[%d]", i)
+		switch {
+		case b.Name == "":
+			v.add(path+".name", "must be set")
+		case backends[b.Name]:
+			v.add(path+".name", "duplicate backend name %s", b.Name)
+		}
+		backends[b.Name] = true
+		if err := checkBaseURL(b.BaseURL); err != nil {
+			v.add(path+".baseUrl", "%s", err)
+		}
+		if b.RSS != nil {
+			v.validateRSS(path+".rss", b.RSS)
+		}
+	}
+
+	if _, err := newFilters(c.Filters); err != nil {
+		v.add("filters", "%s", err)
+	}
+	if _, err := newRanker(c); err != nil {
+		v.add("ranking", "%s", err)
+	}
+	feeds := make(map[string]bool, len(c.VirtualFeeds))
+	for i, vf := range c.VirtualFeeds {
+		path := fmt.Sprintf("virtualFeeds[%d]", i)
+		switch {
+		case vf.Name == "":
+			v.add(path+".name", "must be set")
+		case strings.Contains(vf.Name, "/"):
+			v.add(path+".name", "must not contain /")
+		case feeds[vf.Name]:
+			v.add(path+".name", "duplicate virtual feed name %s", vf.Name)
+		}
+		feeds[vf.Name] = true
+		for j, name := range vf.Backends {
+			if !backends[name] {
+				v.add(fmt.Sprintf("%s.backends[%d]", path, j), "backend %s is not configured", name)
+			}
+		}
+		if _, err := newFilters(vf.Filters); err != nil {
+			v.add(path+".filters", "%s", err)
+		}
+	}
+
+	if c.Retention.MaxAge < 0 {
+		v.add("retention.maxAge", "must not be negative")
+	}
+	if c.Retention.Interval < 0 {
+		v.add("retention.interval", "must not be negative")
+	}
+	for i, rule := range c.Retention.Rules {
+		path := fmt.Sprintf("retention.rules[%d]", i)
+		for j, name := range rule.Backends {
+			if !backends[name] {
+				v.add(fmt.Sprintf("%s.backends[%d]", path, j), "backend %s is not configured", name)
+			}
+		}
+		switch FeedItemSource(rule.Source) {
+		case "", FeedItemSourceRSS, FeedItemSourceSearch:
+		default:
+			v.add(path+".source", "must be rss or search")
+		}
+		if rule.MaxAge < 0 {
+			v.add(path+".maxAge", "must not be negative")
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		v.add("log.level", "%s", err)
+	}
+	if _, err := logging.NewHandler(io.Discard, c.Log.Format, nil); err != nil {
+		v.add("log.format", "%s", err)
+	}
+	if r := c.Tracing.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		v.add("tracing.sampleRatio", "must be between 0 and 1")
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (v *validator) validateRSS(path string, rss *RSSConfig) {
+
+	if rss.RSSPath == "" {
+		v.add(path+".rssPath", "must be set")
+	}
+	names := make(map[string]bool, len(rss.Feeds))
+	for i, feed := range rss.Feeds {
+		feedPath := fmt.Sprintf("%s.feeds[%d]", path, i)
+		switch {
+		case feed.Name == "":
+			v.add(feedPath+".name", "must be set")
+		case names[feed.Name]:
+			v.add(feedPath+".name", "duplicate feed name %s", feed.Name)
+		}
+		names[feed.Name] = true
+		if feed.Cron == "" && feed.PollInterval <= 0 {
+			v.add(feedPath+".pollInterval", "must be positive unless cron is set")
+			continue
+		}
+		if _, err := newFeedScheduler(feed); err != nil {
+			v.add(feedPath, "%s", err)
+		}
+	}
+}
+
+func checkBaseURL(s string) error {
+
+	if s == "" {
+		return errors.New("must be set")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, got %q", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("has no host: %q", s)
+	}
+	return nil
+}
+
+// checkWritableDir checks that files can be created in dir.
+func checkWritableDir(dir string) error {
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".newznab-proxy-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
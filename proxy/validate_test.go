@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Validate(t *testing.T) {
+
+	dir := t.TempDir()
+	c := &Config{
+		Web:     WebConfig{ExternalHost: "proxy.example", Port: 8080},
+		Storage: StorageConfig{DBPath: filepath.Join(dir, "db.sqlite"), NZBDir: dir},
+		Backends: []BackendConfig{
+			{Name: "a", BaseURL: "https://a.example", RSS: &RSSConfig{
+				RSSPath: "rss",
+				Feeds:   []RSSFeed{{Name: "tv", PollInterval: time.Minute}},
+			}},
+		},
+	}
+	assert.NoError(t, c.Validate())
+}
+
+func TestConfig_ValidateReportsAllErrors(t *testing.T) {
+
+	c := &Config{
+		Storage: StorageConfig{DBPath: filepath.Join(t.TempDir(), "missing", "db.sqlite")},
+		Backends: []BackendConfig{
+			{Name: "a", BaseURL: "https://a.example", RSS: &RSSConfig{
+				RSSPath: "rss",
+				Feeds:   []RSSFeed{{Name: "tv"}, {Name: "tv", Cron: "bad"}},
+			}},
+			{Name: "a", BaseURL: "a.example"},
+		},
+		VirtualFeeds: []VirtualFeedConfig{{Name: "hd", Backends: []string{"b"}}},
+	}
+	err := c.Validate()
+	var verr ValidationError
+	require.True(t, errors.As(err, &verr))
+	paths := make([]string, 0, len(verr))
+	for _, fe := range verr {
+		paths = append(paths, fe.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"web.externalHost",
+		"web.port",
+		"storage.dbPath",
+		"backends[0].rss.feeds[0].pollInterval",
+		"backends[0].rss.feeds[1].name",
+		"backends[0].rss.feeds[1]",
+		"backends[1].name",
+		"backends[1].baseUrl",
+		"virtualFeeds[0].backends[0]",
+	}, paths)
+}
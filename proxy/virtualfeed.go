@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/samber/lo"
+)
+
+// VirtualFeed serves the stored items from a subset of backends and
+// categories as a newznab indexer of its own.
+type VirtualFeed struct {
+	p       *Proxy
+	cfg     VirtualFeedConfig
+	filters filters
+	links   LinkRewriter
+}
+
+var _ newznab.ServerImplementation = (*VirtualFeed)(nil)
+
+func newVirtualFeed(p *Proxy, cfg VirtualFeedConfig) (*VirtualFeed, error) {
+
+	for _, name := range cfg.Backends {
+		if _, err := p.backendByName(name); err != nil {
+			return nil, fmt.Errorf("virtual feed %s: backend %s is not configured", cfg.Name, name)
+		}
+	}
+	fs, err := newFilters(cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("virtual feed %s: %w", cfg.Name, err)
+	}
+	ret := &VirtualFeed{
+		p:       p,
+		cfg:     cfg,
+		filters: fs,
+	}
+	ret.links = p.links.WithBasePath(ret.BasePath())
+	return ret, nil
+}
+
+func (v *VirtualFeed) Name() string {
+	return v.cfg.Name
+}
+
+// BasePath is the path the feed is served under.
+func (v *VirtualFeed) BasePath() string {
+	return "/feeds/" + v.cfg.Name
+}
+
+// APIKeys returns the keys allowed to access the feed, or nil if access is
+// governed by the server's keys.
+func (v *VirtualFeed) APIKeys() []string {
+	return v.cfg.APIKeys
+}
+
+func (v *VirtualFeed) Search(ctx context.Context, params newznab.SearchParams) (*newznab.RssFeed, error) {
+
+	if err := checkSort(params.Sort); err != nil {
+		return nil, err
+	}
+	entry := SearchLogEntry{SearchedAt: time.Now(), Feed: v.cfg.Name}
+	if strings.TrimSpace(params.Query) == "" {
+		ret, err := v.RSS(ctx, newznab.RSSParams{
+			Category: params.Category,
+			Limit:    params.Limit,
+			Offset:   params.Offset,
+			Sort:     params.Sort,
+		})
+		if ret != nil {
+			entry.LocalResults = len(ret.Channel.Items)
+		}
+		v.p.logSearch(ctx, params, entry, ret, err)
+		return ret, err
+	}
+	ret, err := v.search(ctx, params, &entry)
+	v.p.logSearch(ctx, params, entry, ret, err)
+	return ret, err
+}
+
+func (v *VirtualFeed) search(ctx context.Context, params newznab.SearchParams, entry *SearchLogEntry) (*newznab.RssFeed, error) {
+
+	cats, ok := v.categories(splitList(params.Category))
+	if !ok {
+		return feedItemsToRssFeed(ctx, nil, v.links), nil
+	}
+	matches, err := v.p.s.SearchForFeedItem(ctx, params.Query)
+	if err != nil {
+		return nil, err
+	}
+	matches = slices.DeleteFunc(matches, func(fi FeedItem) bool {
+		return !v.includes(fi, cats)
+	})
+	set := v.p.current()
+	apiKey := newznab.APIKeyFromContext(ctx)
+	matches = set.filters.apply(matches, apiKey)
+	matches = v.filters.apply(matches, apiKey)
+	entry.LocalResults = len(matches)
+	relevance := make(map[string]float64, len(matches))
+	positionalRelevance(matches, relevance)
+	err = set.order(matches, params, relevance, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return feedItemsToRssFeed(ctx, matches, v.links), nil
+}
+
+func (v *VirtualFeed) RSS(ctx context.Context, params newznab.RSSParams) (*newznab.RssFeed, error) {
+
+	if err := checkSort(params.Sort); err != nil {
+		return nil, err
+	}
+	cats, ok := v.categories(splitList(params.Category))
+	if !ok {
+		return feedItemsToRssFeed(ctx, nil, v.links), nil
+	}
+	backends := v.cfg.Backends
+	if requested := splitList(params.Backend); len(requested) > 0 {
+		if len(backends) > 0 {
+			requested = lo.Intersect(backends, requested)
+		}
+		if len(requested) == 0 {
+			return feedItemsToRssFeed(ctx, nil, v.links), nil
+		}
+		backends = requested
+	}
+	return v.p.recent(ctx, RecentFeedItemsQuery{
+		Indexers:   backends,
+		Categories: cats,
+		Limit:      params.Limit,
+		Offset:     params.Offset,
+	}, params.Sort, v.links, v.filters)
+}
+
+func (v *VirtualFeed) GetNZB(ctx context.Context, id string) (newznab.NZB, error) {
+
+	if err := v.checkItem(ctx, id); err != nil {
+		return newznab.NZB{}, err
+	}
+	return v.p.GetNZB(ctx, id)
+}
+
+func (v *VirtualFeed) Details(ctx context.Context, id string) (*newznab.RssFeed, error) {
+
+	if err := v.checkItem(ctx, id); err != nil {
+		return nil, err
+	}
+	return v.p.details(ctx, id, v.links)
+}
+
+func (v *VirtualFeed) GetNFO(ctx context.Context, id string) (newznab.NFO, error) {
+
+	if err := v.checkItem(ctx, id); err != nil {
+		return newznab.NFO{}, err
+	}
+	return v.p.GetNFO(ctx, id)
+}
+
+func (v *VirtualFeed) Caps(ctx context.Context) (*newznab.Caps, error) {
+
+	return newCaps(v.cfg.Name, capsCategories(v.cfg.Categories)), nil
+}
+
+// checkItem returns an error unless the item with id is part of the feed and
+// passes its filters.
+func (v *VirtualFeed) checkItem(ctx context.Context, id string) error {
+
+	fi, err := v.p.s.GetFeedItemByUUID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return noSuchItemError(id)
+		}
+		return err
+	}
+	apiKey := newznab.APIKeyFromContext(ctx)
+	if !v.includes(fi, v.cfg.Categories) || !v.p.current().filters.allows(fi, apiKey) || !v.filters.allows(fi, apiKey) {
+		return noSuchItemError(id)
+	}
+	return nil
+}
+
+func (v *VirtualFeed) includes(fi FeedItem, cats []string) bool {
+
+	if len(v.cfg.Backends) > 0 && !slices.Contains(v.cfg.Backends, fi.IndexerName) {
+		return false
+	}
+	if len(cats) == 0 {
+		return true
+	}
+	return anyCategoryMatches(cats, fi.categories())
+}
+
+// categories narrows the requested categories to those in the feed. It
+// returns false if none of them are.
+func (v *VirtualFeed) categories(requested []string) ([]string, bool) {
+
+	if len(requested) == 0 {
+		return v.cfg.Categories, true
+	}
+	if len(v.cfg.Categories) == 0 {
+		return requested, true
+	}
+	var ret []string
+	for _, r := range requested {
+		for _, f := range v.cfg.Categories {
+			if categoryMatches(f, r) {
+				ret = append(ret, r)
+			} else if categoryMatches(r, f) {
+				ret = append(ret, f)
+			}
+		}
+	}
+	ret = lo.Uniq(ret)
+	return ret, len(ret) > 0
+}
+
+func newCaps(title string, cats []newznab.CapsCategory) *newznab.Caps {
+
+	return &newznab.Caps{
+		Server: newznab.CapsServer{Version: "1.0", Title: title},
+		Limits: newznab.CapsLimits{Max: maxRSSLimit, Default: defaultRSSLimit},
+		Searching: newznab.CapsSearching{
+			Search:      newznab.NewCapsSearch(true, "q"),
+			TVSearch:    newznab.NewCapsSearch(false, ""),
+			MovieSearch: newznab.NewCapsSearch(false, ""),
+		},
+		Categories: cats,
+	}
+}
+
+// capsCategories returns the standard categories covering ids, or all of them
+// if ids is empty.
+func capsCategories(ids []string) []newznab.CapsCategory {
+
+	if len(ids) == 0 {
+		return newznab.StandardCategories
+	}
+	var ret []newznab.CapsCategory
+	for _, cat := range newznab.StandardCategories {
+		if slices.Contains(ids, cat.ID) {
+			ret = append(ret, cat)
+			continue
+		}
+		subcats := lo.Filter(cat.Subcats, func(item newznab.CapsSubcat, index int) bool {
+			return slices.Contains(ids, item.ID)
+		})
+		if len(subcats) > 0 {
+			cat.Subcats = subcats
+			ret = append(ret, cat)
+		}
+	}
+	return ret
+}
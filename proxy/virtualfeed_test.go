@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualFeed_checkItemFilters(t *testing.T) {
+
+	ctx := context.Background()
+	c := reloadTestConfig(filepath.Join(t.TempDir(), "db.sqlite"))
+	c.Filters = []FilterConfig{{Name: "global", DenyTitles: []string{`\.exe$`}}}
+	c.VirtualFeeds = []VirtualFeedConfig{{
+		Name:    "tv",
+		Filters: []FilterConfig{{Name: "feed", DenyTitles: []string{`german`}}},
+	}}
+	p, err := NewProxy(ctx, c)
+	require.NoError(t, err)
+	for _, fi := range []FeedItem{
+		{UUID: "ok", IndexerName: "a", Title: "Some.Show.S01E01"},
+		{UUID: "global", IndexerName: "a", Title: "Some.Show.S01E02.exe"},
+		{UUID: "feed", IndexerName: "a", Title: "Some.Show.S01E03.German"},
+	} {
+		fi.PubDate = time.Now()
+		require.NoError(t, p.s.InsertFeedItem(ctx, fi))
+	}
+	v := p.VirtualFeeds()[0]
+
+	assert.NoError(t, v.checkItem(ctx, "ok"))
+	for _, id := range []string{"global", "feed", "missing"} {
+		assert.Equal(t, noSuchItemError(id), v.checkItem(ctx, id), id)
+	}
+	_, err = v.Details(ctx, "feed")
+	var srvErr newznab.ServerError
+	assert.ErrorAs(t, err, &srvErr)
+}
@@ -0,0 +1,332 @@
+package release
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Info is the structured information parsed from a scene-style release name.
+type Info struct {
+	// Name is the show or movie name.
+	Name string
+	// Year is 0 if not present.
+	Year int
+	// Season is 0 if not present.
+	Season   int
+	Episodes []int
+
+	Resolution string
+	Source     string
+	Codec      string
+	Audio      string
+	Languages  []string
+	Group      string
+
+	Proper   bool
+	Repack   bool
+	Internal bool
+}
+
+// Attribute names used by Info.Attrs. Where newznab defines a standard
+// attribute for a field, its name is used.
+const (
+	AttrName       = "name"
+	AttrYear       = "year"
+	AttrSeason     = "season"
+	AttrEpisode    = "episode"
+	AttrResolution = "resolution"
+	AttrSource     = "source"
+	AttrCodec      = "video"
+	AttrAudio      = "audio"
+	AttrLanguage   = "language"
+	AttrGroup      = "team"
+	AttrProper     = "proper"
+	AttrRepack     = "repack"
+	AttrInternal   = "internal"
+)
+
+// token matches expr only when it is delimited by non-alphanumeric characters
+// or the ends of the string. The match is in submatch group 1.
+func token(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(` + expr + `)(?:$|[^a-z0-9])`)
+}
+
+type pattern struct {
+	re    *regexp.Regexp
+	value string
+}
+
+var (
+	episodeRe    = token(`s(\d{1,2})[ .]?e(\d{1,3})(?:-?e(\d{1,3})|-(\d{1,3}))*`)
+	crossEpRe    = token(`(\d{1,2})x(\d{2,3})`)
+	seasonPackRe = token(`s(\d{1,2})|season[ .](\d{1,2})`)
+	yearRe       = token(`(?:19|20)\d{2}`)
+	groupRe      = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	trailerRe    = regexp.MustCompile(`(?i)(\.nzb|\.mkv|\.mp4|\.avi|\s*\[[^\]]*\])+$`)
+
+	properRe   = token(`proper`)
+	repackRe   = token(`repack|rerip`)
+	internalRe = token(`internal`)
+
+	resolutions = []pattern{
+		{token(`2160p|4k|uhd`), "2160p"},
+		{token(`1080[pi]`), "1080p"},
+		{token(`720p`), "720p"},
+		{token(`576p`), "576p"},
+		{token(`480p`), "480p"},
+	}
+	sources = []pattern{
+		{token(`remux`), "remux"},
+		{token(`blu-?ray|bdrip|brrip|bd25|bd50`), "bluray"},
+		{token(`web-?dl`), "webdl"},
+		{token(`web-?rip`), "webrip"},
+		{token(`web`), "web"},
+		{token(`hdtv`), "hdtv"},
+		{token(`pdtv|sdtv|dsr`), "sdtv"},
+		{token(`dvd-?rip`), "dvdrip"},
+		{token(`dvd(?:r|5|9)?`), "dvd"},
+		{token(`hd-?rip`), "hdrip"},
+		{token(`telesync|ts`), "telesync"},
+		{token(`cam(?:rip)?`), "cam"},
+	}
+	codecs = []pattern{
+		{token(`[xh]\.?265|hevc`), "h265"},
+		{token(`[xh]\.?264|avc`), "h264"},
+		{token(`av1`), "av1"},
+		{token(`xvid|divx`), "xvid"},
+		{token(`vc-?1`), "vc1"},
+		{token(`mpeg-?2`), "mpeg2"},
+	}
+	audios = []pattern{
+		{token(`atmos`), "atmos"},
+		{token(`truehd`), "truehd"},
+		{token(`dts-?hd(?:[ .-]?ma)?|dts-?x`), "dtshd"},
+		{token(`dts`), "dts"},
+		{token(`ddp(?:[ .]?\d\.\d)?|dd\+|e-?ac-?3`), "eac3"},
+		{token(`dd(?:[ .]?\d\.\d)?|ac-?3`), "ac3"},
+		{token(`aac(?:[ .]?\d\.\d)?`), "aac"},
+		{token(`flac`), "flac"},
+		{token(`opus`), "opus"},
+		{token(`mp3`), "mp3"},
+	}
+	languages = []pattern{
+		{token(`multi`), "multi"},
+		{token(`english|eng`), "english"},
+		{token(`french|vostfr|truefrench`), "french"},
+		{token(`german`), "german"},
+		{token(`spanish|castellano|esp`), "spanish"},
+		{token(`italian|ita`), "italian"},
+		{token(`dutch|flemish`), "dutch"},
+		{token(`russian|rus`), "russian"},
+		{token(`japanese|jpn`), "japanese"},
+		{token(`korean|kor`), "korean"},
+		{token(`chinese|chs|cht`), "chinese"},
+		{token(`hindi`), "hindi"},
+		{token(`polish`), "polish"},
+		{token(`swedish|swe`), "swedish"},
+		{token(`danish`), "danish"},
+		{token(`norwegian`), "norwegian"},
+		{token(`finnish`), "finnish"},
+	}
+)
+
+// Parse extracts whatever structured information it can from title. Fields
+// that cannot be determined are left at their zero value.
+func Parse(title string) Info {
+
+	var ret Info
+	s := trailerRe.ReplaceAllString(strings.TrimSpace(title), "")
+	s = strings.ReplaceAll(s, "_", ".")
+
+	// The name runs until the first marker that can't plausibly be part of it.
+	nameEnd := len(s)
+	mark := func(idx int) {
+		if idx > 0 && idx < nameEnd {
+			nameEnd = idx
+		}
+	}
+
+	if m := episodeRe.FindStringSubmatchIndex(s); m != nil {
+		mark(m[2])
+		ret.Season = atoi(s[m[4]:m[5]])
+		ret.Episodes = episodes(s[m[2]:m[3]])
+	} else if m := crossEpRe.FindStringSubmatchIndex(s); m != nil {
+		mark(m[2])
+		ret.Season = atoi(s[m[4]:m[5]])
+		ret.Episodes = []int{atoi(s[m[6]:m[7]])}
+	} else if m := seasonPackRe.FindStringSubmatchIndex(s); m != nil && m[2] > 0 {
+		mark(m[2])
+		if m[4] >= 0 {
+			ret.Season = atoi(s[m[4]:m[5]])
+		} else {
+			ret.Season = atoi(s[m[6]:m[7]])
+		}
+	}
+	// A year at the very start is more likely part of the name, e.g. 2012.
+	if m := yearRe.FindStringSubmatchIndex(s); m != nil {
+		if m[2] == 0 {
+			// token consumes the trailing delimiter, so resume from the end
+			// of the group rather than using FindAll.
+			off := m[3]
+			m = yearRe.FindStringSubmatchIndex(s[off:])
+			for i := range m {
+				m[i] += off
+			}
+		}
+		if m != nil {
+			mark(m[2])
+			ret.Year = atoi(s[m[2]:m[3]])
+		}
+	}
+	// Quality tags follow the episode marker or year when there is one, so
+	// that a name such as Web.Therapy isn't taken for a source. Without one,
+	// they're what ends the name.
+	from := 0
+	if nameEnd < len(s) {
+		from = nameEnd
+	}
+	var idx int
+	ret.Resolution, idx = match(s, from, resolutions)
+	mark(idx)
+	ret.Source, idx = match(s, from, sources)
+	mark(idx)
+	for _, flag := range []struct {
+		re  *regexp.Regexp
+		val *bool
+	}{{properRe, &ret.Proper}, {repackRe, &ret.Repack}, {internalRe, &ret.Internal}} {
+		if m := find(flag.re, s, from); m != nil {
+			*flag.val = true
+			mark(m[2])
+		}
+	}
+
+	ret.Name = cleanName(s[:nameEnd])
+	if nameEnd == len(s) {
+		return ret
+	}
+	// Everything else is only looked for after the name, so that words such
+	// as "German" in a title aren't mistaken for release tags.
+	rest := s[nameEnd:]
+	ret.Codec, _ = match(rest, 0, codecs)
+	ret.Audio, _ = match(rest, 0, audios)
+	for _, p := range languages {
+		if p.re.MatchString(rest) {
+			ret.Languages = append(ret.Languages, p.value)
+		}
+	}
+	if m := groupRe.FindStringSubmatch(rest); m != nil {
+		ret.Group = m[1]
+	}
+	return ret
+}
+
+// Attrs returns the parsed fields as newznab-style attributes, omitting any
+// that weren't found.
+func (i Info) Attrs() map[string]string {
+
+	ret := make(map[string]string)
+	set := func(k, v string) {
+		if v != "" {
+			ret[k] = v
+		}
+	}
+	set(AttrName, i.Name)
+	if i.Year != 0 {
+		set(AttrYear, strconv.Itoa(i.Year))
+	}
+	if i.Season != 0 {
+		set(AttrSeason, fmt.Sprintf("S%02d", i.Season))
+	}
+	var eps strings.Builder
+	for _, ep := range i.Episodes {
+		fmt.Fprintf(&eps, "E%02d", ep)
+	}
+	set(AttrEpisode, eps.String())
+	set(AttrResolution, i.Resolution)
+	set(AttrSource, i.Source)
+	set(AttrCodec, i.Codec)
+	set(AttrAudio, i.Audio)
+	set(AttrLanguage, strings.Join(i.Languages, ","))
+	set(AttrGroup, i.Group)
+	if i.Proper {
+		set(AttrProper, "1")
+	}
+	if i.Repack {
+		set(AttrRepack, "1")
+	}
+	if i.Internal {
+		set(AttrInternal, "1")
+	}
+	return ret
+}
+
+// match returns the value of the first pattern that matches s at or after
+// from and the index the match starts at, or -1 if none do.
+func match(s string, from int, patterns []pattern) (string, int) {
+
+	for _, p := range patterns {
+		if m := find(p.re, s, from); m != nil {
+			return p.value, m[2]
+		}
+	}
+	return "", -1
+}
+
+// find returns the submatch indexes of the first match of re in s at or
+// after from. A match at the very start of s is skipped, as it can only be
+// part of the name.
+func find(re *regexp.Regexp, s string, from int) []int {
+
+	for from < len(s) {
+		m := re.FindStringSubmatchIndex(s[from:])
+		if m == nil {
+			return nil
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += from
+			}
+		}
+		if m[2] > 0 {
+			return m
+		}
+		// token consumes the trailing delimiter, so resume from the end of
+		// the group.
+		from = m[3]
+	}
+	return nil
+}
+
+var episodeNumRe = regexp.MustCompile(`(?i)(?:e|-)(\d{1,3})`)
+
+// episodes expands an episode marker such as S01E01E02 or S01E01-03.
+func episodes(marker string) []int {
+
+	var ret []int
+	for _, m := range episodeNumRe.FindAllStringSubmatch(marker, -1) {
+		ret = append(ret, atoi(m[1]))
+	}
+	if strings.Contains(marker, "-") && len(ret) == 2 && ret[1] > ret[0] && ret[1]-ret[0] < 50 {
+		start, end := ret[0], ret[1]
+		ret = ret[:0]
+		for ep := start; ep <= end; ep++ {
+			ret = append(ret, ep)
+		}
+	}
+	return ret
+}
+
+var nameSeparatorRe = regexp.MustCompile(`[.\s]+`)
+
+func cleanName(s string) string {
+
+	s = nameSeparatorRe.ReplaceAllString(s, " ")
+	return strings.Trim(s, " -([")
+}
+
+func atoi(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
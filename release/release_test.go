@@ -0,0 +1,97 @@
+package release_test
+
+import (
+	"testing"
+
+	"github.com/henges/newznab-proxy/release"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		title string
+		want  release.Info
+	}{
+		{
+			title: "Show.Name.S01E02.720p.HDTV.x264-GRP",
+			want: release.Info{
+				Name: "Show Name", Season: 1, Episodes: []int{2},
+				Resolution: "720p", Source: "hdtv", Codec: "h264", Group: "GRP",
+			},
+		},
+		{
+			title: "Movie.Name.2019.1080p.BluRay.DTS-HD.MA.5.1.x265-GROUP",
+			want: release.Info{
+				Name: "Movie Name", Year: 2019,
+				Resolution: "1080p", Source: "bluray", Codec: "h265", Audio: "dtshd", Group: "GROUP",
+			},
+		},
+		{
+			title: "2012.2009.2160p.UHD.WEB-DL.DDP5.1.Atmos.H.265-XYZ",
+			want: release.Info{
+				Name: "2012", Year: 2009,
+				Resolution: "2160p", Source: "webdl", Codec: "h265", Audio: "atmos", Group: "XYZ",
+			},
+		},
+		{
+			title: "Show Name S02E03-E05 PROPER REPACK GERMAN 1080p WEB h264-TEAM",
+			want: release.Info{
+				Name: "Show Name", Season: 2, Episodes: []int{3, 4, 5},
+				Resolution: "1080p", Source: "web", Codec: "h264", Languages: []string{"german"},
+				Group: "TEAM", Proper: true, Repack: true,
+			},
+		},
+		{
+			title: "The.German.Doctor.2013.MULTi.720p.BluRay.x264-FOO",
+			want: release.Info{
+				Name: "The German Doctor", Year: 2013,
+				Resolution: "720p", Source: "bluray", Codec: "h264", Languages: []string{"multi"}, Group: "FOO",
+			},
+		},
+		{
+			title: "Show.Name.S03.1080p.AMZN.WEBRip.AAC2.0.x264-GRP",
+			want: release.Info{
+				Name: "Show Name", Season: 3,
+				Resolution: "1080p", Source: "webrip", Codec: "h264", Audio: "aac", Group: "GRP",
+			},
+		},
+		{
+			title: "Web.Therapy.S01E01.720p.HDTV.x264-GRP",
+			want: release.Info{
+				Name: "Web Therapy", Season: 1, Episodes: []int{1},
+				Resolution: "720p", Source: "hdtv", Codec: "h264", Group: "GRP",
+			},
+		},
+		{
+			title: "The.Internal.Affairs.of.Cam.Town.2021.REPACK.1080p.WEB-DL.x264-GRP",
+			want: release.Info{
+				Name: "The Internal Affairs of Cam Town", Year: 2021,
+				Resolution: "1080p", Source: "webdl", Codec: "h264", Group: "GRP", Repack: true,
+			},
+		},
+		{
+			title: "Spider-Man",
+			want:  release.Info{Name: "Spider-Man"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, release.Parse(tt.title))
+		})
+	}
+}
+
+func TestInfo_Attrs(t *testing.T) {
+
+	attrs := release.Parse("Show.Name.S01E02E03.720p.HDTV.x264-GRP").Attrs()
+	assert.Equal(t, map[string]string{
+		release.AttrName:       "Show Name",
+		release.AttrSeason:     "S01",
+		release.AttrEpisode:    "E02E03",
+		release.AttrResolution: "720p",
+		release.AttrSource:     "hdtv",
+		release.AttrCodec:      "h264",
+		release.AttrGroup:      "GRP",
+	}, attrs)
+}
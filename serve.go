@@ -0,0 +1,205 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/henges/newznab-proxy/admin"
+	"github.com/henges/newznab-proxy/logging"
+	"github.com/henges/newznab-proxy/metrics"
+	"github.com/henges/newznab-proxy/newznab"
+	"github.com/henges/newznab-proxy/proxy"
+	"github.com/henges/newznab-proxy/webui"
+	"github.com/spf13/cobra"
+)
+
+func serveCmd() *cobra.Command {
+
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the proxy server and RSS pollers",
+		Args:  cobra.NoArgs,
+		RunE:  runServe,
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+
+	ctx := cmd.Context()
+	cfg, prox, err := openProxy(ctx)
+	if err != nil {
+		return err
+	}
+	stopTracing, err := proxy.StartTracing(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	prox.StartRSSPolls(ctx)
+
+	apiKeys := func() ([]string, error) {
+		return prox.APIKeys(ctx)
+	}
+	metrics.Registry.MustRegister(prox.DBCollector())
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	if cfg.Admin.APIKey != "" {
+		mux.Handle(admin.BasePath+"/", admin.NewHandler(prox, cfg.Admin.APIKey))
+	}
+	ui := webui.NewHandler(prox, apiKeys)
+	mux.Handle(webui.BasePath, ui)
+	mux.Handle(webui.BasePath+"/", ui)
+	for _, vf := range prox.VirtualFeeds() {
+		keys := apiKeys
+		if vfKeys := vf.APIKeys(); len(vfKeys) > 0 {
+			keys = func() ([]string, error) {
+				return vfKeys, nil
+			}
+		}
+		vfSrv := newznab.NewServer(vf, newznab.WithAPIKeyValidation(keys), newznab.WithSignedLinks(prox.LinkSigner()))
+		mux.Handle(vf.BasePath()+"/", http.StripPrefix(vf.BasePath(), vfSrv.Handler()))
+	}
+
+	srv := newznab.NewServer(prox, newznab.WithAPIKeyValidation(apiKeys), newznab.WithSignedLinks(prox.LinkSigner()), newznab.WithMiddleware(func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get("X-Request-Id")
+			if !validRequestID.MatchString(id) {
+				id = logging.NewRequestID()
+			}
+			rw.Header().Set("X-Request-Id", id)
+			r = r.WithContext(logging.ContextWithRequestID(r.Context(), id))
+			lmw := &loggingMiddleware{rw, 0}
+			handler.ServeHTTP(lmw, r)
+			dur := time.Since(start)
+			endpoint := endpointLabel(r)
+			metrics.Requests.WithLabelValues(endpoint, strconv.Itoa(cmp.Or(lmw.statusCode, http.StatusOK))).Inc()
+			metrics.RequestDuration.WithLabelValues(endpoint).Observe(dur.Seconds())
+			if r.URL.Path == "/healthz" || r.URL.Path == "/favicon.ico" {
+				return
+			}
+			slog.InfoContext(r.Context(), "request", "method", r.Method, "url", logging.Redact(r.URL.String()),
+				"status", cmp.Or(lmw.statusCode, http.StatusOK), "duration", dur)
+		})
+	}))
+	hsrv := http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Web.ListenAddr, cfg.Web.Port),
+		Handler: srv.HandlerWithMux(mux),
+	}
+	go func() {
+		hsrv.ListenAndServe()
+	}()
+	slog.Info("server up", "addr", hsrv.Addr)
+
+	reload := func() {
+		c, err := proxy.LoadConfig(configPath)
+		if err != nil {
+			slog.Error("error reloading config", "err", err)
+			return
+		}
+		err = applyLogLevel(c)
+		if err != nil {
+			slog.Error("error reloading config", "err", err)
+			return
+		}
+		err = prox.Reload(ctx, c)
+		if err != nil {
+			slog.Error("error reloading config", "err", err)
+			return
+		}
+		slog.Info("config reloaded")
+	}
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	err = proxy.WatchConfigFile(watchCtx, configPath, reload)
+	if err != nil {
+		slog.Warn("not watching config file for changes", "err", err)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range ch {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reload()
+	}
+	// Stop reloading before shutting down, so no pollers are started while
+	// they are being stopped.
+	signal.Stop(ch)
+	stopWatching()
+
+	err = hsrv.Shutdown(ctx)
+	if err != nil {
+		slog.Error("error shutting down http server", "err", err)
+	}
+	err = prox.StopRSSPolls()
+	if err != nil {
+		slog.Error("error shutting down RSS polls", "err", err)
+	}
+	err = stopTracing(ctx)
+	if err != nil {
+		slog.Error("error flushing traces", "err", err)
+	}
+	return nil
+}
+
+// validRequestID matches request IDs that are passed on from the client
+// rather than replaced.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// apiTypes are the values of t recorded as endpoints in metrics. Any others
+// are recorded as "api", to bound the number of series.
+var apiTypes = map[string]bool{
+	"caps": true, "search": true, "tvsearch": true, "movie": true, "get": true, "details": true, "getnfo": true,
+}
+
+// endpointLabel returns the endpoint r is recorded under in metrics.
+func endpointLabel(r *http.Request) string {
+
+	p := r.URL.Path
+	switch {
+	case strings.HasSuffix(p, "/api"):
+		if t := r.URL.Query().Get("t"); apiTypes[t] {
+			return t
+		}
+		return "api"
+	case strings.HasSuffix(p, "/rss"):
+		return "rss"
+	case strings.Contains(p, "/getnzb/"):
+		return "getnzb"
+	case strings.HasPrefix(p, admin.BasePath):
+		return "admin"
+	case strings.HasPrefix(p, webui.BasePath):
+		return "ui"
+	case p == "/metrics" || p == "/healthz":
+		return p[1:]
+	}
+	return "other"
+}
+
+type loggingMiddleware struct {
+	d          http.ResponseWriter
+	statusCode int
+}
+
+func (l *loggingMiddleware) Header() http.Header {
+	return l.d.Header()
+}
+
+func (l *loggingMiddleware) Write(bytes []byte) (int, error) {
+	return l.d.Write(bytes)
+}
+
+func (l *loggingMiddleware) WriteHeader(statusCode int) {
+	l.statusCode = statusCode
+	l.d.WriteHeader(statusCode)
+}
@@ -0,0 +1,277 @@
+"use strict";
+
+const NS = "http://www.newznab.com/DTD/2010/feeds/attributes/";
+const PAGE_SIZE = 50;
+
+const $ = (sel, root = document) => root.querySelector(sel);
+const $$ = (sel, root = document) => Array.from(root.querySelectorAll(sel));
+
+const keyInput = $("#apikey");
+keyInput.value = localStorage.getItem("apikey") || "";
+keyInput.addEventListener("change", () => {
+  localStorage.setItem("apikey", keyInput.value);
+  init();
+});
+
+function apiKey() {
+  return keyInput.value.trim();
+}
+
+function showError(msg) {
+  const el = $("#error");
+  el.textContent = msg || "";
+  el.hidden = !msg;
+}
+
+function el(tag, attrs = {}, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs)) {
+    if (k === "class") e.className = v;
+    else e.setAttribute(k, v);
+  }
+  for (const c of children) {
+    e.append(c instanceof Node ? c : String(c ?? ""));
+  }
+  return e;
+}
+
+// fetchXML requests a newznab endpoint and returns the parsed document,
+// throwing if the server responded with a newznab error.
+async function fetchXML(path, params) {
+  const q = new URLSearchParams({ ...params, apikey: apiKey() });
+  for (const [k, v] of [...q]) {
+    if (v === "") q.delete(k);
+  }
+  const res = await fetch(`${path}?${q}`);
+  const doc = new DOMParser().parseFromString(await res.text(), "application/xml");
+  const err = doc.querySelector("error");
+  if (err) {
+    throw new Error(err.getAttribute("description") || `error ${err.getAttribute("code")}`);
+  }
+  if (!res.ok) {
+    throw new Error(`${res.status} ${res.statusText}`);
+  }
+  return doc;
+}
+
+async function fetchJSON(path) {
+  const res = await fetch(path, { headers: { "X-Api-Key": apiKey() } });
+  const body = await res.json();
+  if (!res.ok) {
+    throw new Error(body.error || `${res.status} ${res.statusText}`);
+  }
+  return body;
+}
+
+function parseItems(doc) {
+  return $$("item", doc).map((item) => {
+    const attrs = {};
+    for (const a of item.getElementsByTagNameNS(NS, "attr")) {
+      attrs[a.getAttribute("name")] = a.getAttribute("value");
+    }
+    const enclosure = item.querySelector("enclosure");
+    return {
+      title: item.querySelector("title")?.textContent,
+      pubDate: item.querySelector("pubDate")?.textContent,
+      link: enclosure?.getAttribute("url") || item.querySelector("link")?.textContent,
+      size: Number(enclosure?.getAttribute("length") || attrs.size || 0),
+      attrs,
+    };
+  });
+}
+
+// downloadURL adds the API key to links that aren't signed.
+function downloadURL(link) {
+  const u = new URL(link, location.href);
+  if (!u.searchParams.has("sig") && !u.searchParams.has("apikey")) {
+    u.searchParams.set("apikey", apiKey());
+  }
+  return u.toString();
+}
+
+function formatSize(n) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${n.toFixed(i > 1 ? 1 : 0)} ${units[i]}`;
+}
+
+function formatAge(date) {
+  const d = new Date(date);
+  if (isNaN(d)) return "";
+  const hours = (Date.now() - d) / 36e5;
+  if (hours < 1) return `${Math.max(0, Math.round(hours * 60))}m`;
+  if (hours < 48) return `${Math.round(hours)}h`;
+  return `${Math.round(hours / 24)}d`;
+}
+
+let categoryNames = {};
+
+function renderItems(container, items) {
+  container.replaceChildren();
+  if (items.length === 0) {
+    container.append(el("p", { class: "muted" }, "No results."));
+    return;
+  }
+  const rows = items.map((it) =>
+    el("tr", {},
+      el("td", { class: "title" }, it.title),
+      el("td", {}, categoryNames[it.attrs.category] || it.attrs.category),
+      el("td", { class: "num" }, formatSize(it.size)),
+      el("td", { class: "num", title: it.pubDate }, formatAge(it.pubDate)),
+      el("td", { class: "num" }, it.attrs.grabs ?? ""),
+      el("td", {}, el("a", { href: downloadURL(it.link) }, "Download")),
+    ));
+  container.append(el("table", {},
+    el("thead", {}, el("tr", {},
+      el("th", {}, "Title"), el("th", {}, "Category"), el("th", {}, "Size"),
+      el("th", {}, "Age"), el("th", {}, "Grabs"), el("th"))),
+    el("tbody", {}, ...rows)));
+}
+
+async function loadCategories() {
+  const doc = await fetchXML("/api", { t: "caps" });
+  categoryNames = {};
+  const options = [];
+  for (const cat of $$("categories > category", doc)) {
+    const name = cat.getAttribute("name");
+    categoryNames[cat.getAttribute("id")] = name;
+    options.push(el("option", { value: cat.getAttribute("id") }, name));
+    for (const sub of $$("subcat", cat)) {
+      const subName = `${name} > ${sub.getAttribute("name")}`;
+      categoryNames[sub.getAttribute("id")] = subName;
+      options.push(el("option", { value: sub.getAttribute("id") }, `  ${subName}`));
+    }
+  }
+  for (const sel of $$("select.categories")) {
+    sel.replaceChildren(sel.options[0], ...options.map((o) => o.cloneNode(true)));
+  }
+}
+
+async function loadBackends() {
+  const backends = await fetchJSON("api/backends");
+  const sel = $("select.backends");
+  sel.replaceChildren(sel.options[0], ...backends.map((b) => el("option", { value: b.name }, b.name)));
+  return backends;
+}
+
+$("#search-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const out = $("#tab-search .results");
+  out.replaceChildren(el("p", { class: "muted" }, "Searching…"));
+  try {
+    const doc = await fetchXML("/api", {
+      t: "search",
+      q: form.get("q"),
+      cat: form.get("cat"),
+      sort: form.get("sort"),
+    });
+    showError();
+    renderItems(out, parseItems(doc));
+  } catch (err) {
+    out.replaceChildren();
+    showError(err.message);
+  }
+});
+
+let recentOffset = 0;
+
+async function loadRecent() {
+  const form = new FormData($("#recent-form"));
+  const out = $("#tab-recent .results");
+  try {
+    const doc = await fetchXML("/rss", {
+      backend: form.get("backend"),
+      cat: form.get("cat"),
+      limit: PAGE_SIZE,
+      offset: recentOffset,
+    });
+    showError();
+    const items = parseItems(doc);
+    renderItems(out, items);
+    $("#recent-prev").disabled = recentOffset === 0;
+    $("#recent-next").disabled = items.length < PAGE_SIZE;
+  } catch (err) {
+    out.replaceChildren();
+    showError(err.message);
+  }
+}
+
+$("#recent-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  recentOffset = 0;
+  loadRecent();
+});
+$("#recent-prev").addEventListener("click", () => {
+  recentOffset = Math.max(0, recentOffset - PAGE_SIZE);
+  loadRecent();
+});
+$("#recent-next").addEventListener("click", () => {
+  recentOffset += PAGE_SIZE;
+  loadRecent();
+});
+
+function usageCell(used, limit) {
+  if (!limit) return el("td", { class: "num" }, used);
+  const pct = Math.min(100, (used / limit) * 100);
+  const bar = el("div", { class: used >= limit ? "bar over" : "bar" }, el("div", { style: `width: ${pct}%` }));
+  return el("td", { class: "num" }, `${used} / ${limit}`, bar);
+}
+
+async function loadIndexers() {
+  const out = $("#tab-indexers .results");
+  try {
+    const backends = await loadBackends();
+    showError();
+    const rows = backends.map((b) => {
+      const s = b.searches || {};
+      return el("tr", {},
+        el("td", {}, b.name, el("br"), el("span", { class: "muted" }, b.baseUrl)),
+        el("td", { class: b.healthy ? "ok" : "bad" }, b.healthy ? "Healthy" : "Failing"),
+        el("td", { class: "num" }, `${s.hit || 0} / ${s.miss || 0} / ${s.error || 0}`),
+        el("td", { class: "num" }, b.feeds ? `${b.feeds - b.failingFeeds} / ${b.feeds}` : "-"),
+        usageCell(b.usage.apiRequests, b.usage.apiLimit),
+        usageCell(b.usage.grabs, b.usage.grabLimit),
+        el("td", {}, b.lastError || "",
+          b.lastErrorAt ? el("span", { class: "muted" }, ` (${formatAge(b.lastErrorAt)} ago)`) : ""),
+      );
+    });
+    out.replaceChildren(el("table", {},
+      el("thead", {}, el("tr", {},
+        el("th", {}, "Indexer"), el("th", {}, "Status"), el("th", {}, "Searches (hit / miss / error)"),
+        el("th", {}, "Feeds OK"), el("th", {}, "API requests (24h)"), el("th", {}, "Grabs (24h)"),
+        el("th", {}, "Last error"))),
+      el("tbody", {}, ...rows)));
+  } catch (err) {
+    out.replaceChildren();
+    showError(err.message);
+  }
+}
+
+for (const btn of $$("nav button")) {
+  btn.addEventListener("click", () => {
+    for (const b of $$("nav button")) b.classList.toggle("active", b === btn);
+    for (const s of $$("main section")) s.hidden = s.id !== `tab-${btn.dataset.tab}`;
+    if (btn.dataset.tab === "indexers") loadIndexers();
+    if (btn.dataset.tab === "recent" && !$("#tab-recent .results").hasChildNodes()) loadRecent();
+  });
+}
+
+async function init() {
+  if (!apiKey()) {
+    showError("Enter an API key to get started.");
+    return;
+  }
+  try {
+    await Promise.all([loadCategories(), loadBackends()]);
+    showError();
+  } catch (err) {
+    showError(err.message);
+  }
+}
+
+init();
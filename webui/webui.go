@@ -0,0 +1,86 @@
+// Package webui serves a browser interface for searching and grabbing
+// through the proxy. All assets are embedded, so it works offline.
+package webui
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"slices"
+
+	"github.com/henges/newznab-proxy/proxy"
+)
+
+// BasePath is the path the web UI is served under.
+const BasePath = "/ui"
+
+//go:embed static
+var static embed.FS
+
+type Handler struct {
+	p       *proxy.Proxy
+	apiKeys func() ([]string, error)
+	mux     *http.ServeMux
+}
+
+// NewHandler returns the web UI for p. The UI itself is public, but it uses
+// the newznab API with a key entered by the user, and its own endpoints accept
+// the same keys as that API.
+func NewHandler(p *proxy.Proxy, apiKeys func() ([]string, error)) *Handler {
+
+	h := &Handler{
+		p:       p,
+		apiKeys: apiKeys,
+		mux:     http.NewServeMux(),
+	}
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	h.mux.Handle("GET "+BasePath+"/{$}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(rw, r, assets, "index.html")
+	}))
+	h.mux.Handle("GET "+BasePath+"/static/", http.StripPrefix(BasePath+"/static/", http.FileServerFS(assets)))
+	h.mux.HandleFunc("GET "+BasePath+"/api/backends", h.listBackends)
+	h.mux.Handle("GET "+BasePath, http.RedirectHandler(BasePath+"/", http.StatusMovedPermanently))
+	return h
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(rw, r)
+}
+
+func (h *Handler) listBackends(rw http.ResponseWriter, r *http.Request) {
+
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		key = r.URL.Query().Get("apikey")
+	}
+	keys, err := h.apiKeys()
+	if err != nil {
+		respondJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	if !slices.Contains(keys, key) {
+		respondJSON(rw, http.StatusUnauthorized, errorResponse{Error: "Unauthorized"})
+		return
+	}
+	res, err := h.p.BackendStatuses(r.Context())
+	if err != nil {
+		respondJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	respondJSON(rw, http.StatusOK, res)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func respondJSON(rw http.ResponseWriter, code int, v any) {
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v)
+}